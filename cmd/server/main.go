@@ -45,12 +45,107 @@ func main() {
 	}
 
 	urlRepo := repository.NewCachedRepository(db, redisClient, cfg.BaseURL, 24*time.Hour)
-	urlService := service.NewURLService(urlRepo, cfg.BaseURL, cfg.Duration)
+	codeGenerator, err := newCodeGenerator(cfg.ShortCode, repository.NewPostgresSequence(db, repository.ShortCodeSequence))
+	if err != nil {
+		log.Fatalf("Failed to configure short code generator: %v", err)
+	}
+
+	var keyPool *service.KeyPool
+	if cfg.KeyPool.Enabled {
+		keyPool = service.NewKeyPool(repository.NewKeyPoolRepository(db), codeGenerator, service.KeyPoolConfig{
+			Owner:          processOwner(),
+			LeaseSize:      cfg.KeyPool.LeaseSize,
+			LowWatermark:   cfg.KeyPool.LowWatermark,
+			LeaseTTL:       cfg.KeyPool.LeaseTTL,
+			RefillInterval: cfg.KeyPool.RefillInterval,
+			MinAvailable:   int64(cfg.KeyPool.MinAvailable),
+			GenerateBatch:  cfg.KeyPool.GenerateBatch,
+		})
+		keyPool.Start(ctx)
+		codeGenerator = keyPool
+	}
+
+	switch cfg.DefaultRedirect {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		log.Fatalf("Invalid DEFAULT_REDIRECT_TYPE %d: must be 301, 302, 307 or 308", cfg.DefaultRedirect)
+	}
+
+	accessRecorder := service.NewAccessRecorder(urlRepo, cfg.AccessFlushInterval)
+	accessRecorder.Start(ctx)
+
 	statsService := service.NewStatsService(redisClient)
+	passwordLimiter := repository.NewRedisAttemptLimiter(redisClient, "password:attempts", cfg.PasswordMaxAttempts, cfg.PasswordLockout)
+
+	var geoLocator service.GeoLocator
+	if cfg.GeoIPDatabase != "" {
+		locator, err := service.NewMaxMindLocator(cfg.GeoIPDatabase)
+		if err != nil {
+			log.Fatalf("Failed to load GeoIP database: %v", err)
+		}
+		defer locator.Close()
+		geoLocator = locator
+	}
+
+	var validators []service.URLValidator
+	if cfg.Safety.Heuristics {
+		validators = append(validators, service.HeuristicValidator{})
+	}
+	if cfg.Safety.DomainList != "" {
+		domainList, err := service.NewDomainListValidator(cfg.Safety.DomainList)
+		if err != nil {
+			log.Fatalf("Failed to load URL_DOMAIN_LIST: %v", err)
+		}
+		domainList.Watch(ctx, cfg.Safety.ReloadInterval)
+		validators = append(validators, domainList)
+	}
+	if cfg.Safety.HashList != "" {
+		hashList, err := service.NewHashPrefixValidator(cfg.Safety.HashList)
+		if err != nil {
+			log.Fatalf("Failed to load URL_HASH_LIST: %v", err)
+		}
+		hashList.Watch(ctx, cfg.Safety.ReloadInterval)
+		validators = append(validators, hashList)
+	}
+
+	var shortenerClient *http.Client
+	if cfg.Safety.ResolveShorteners {
+		shortenerClient = &http.Client{}
+	}
+
+	urlService := service.NewURLService(urlRepo, cfg.BaseURL, cfg.Duration,
+		service.WithCodeGenerator(codeGenerator),
+		service.WithDeduplication(cfg.Dedupe.Enabled, cfg.Dedupe.PerOwner),
+		service.WithExpirationBounds(cfg.MinDuration, cfg.MaxDuration, cfg.AllowPermanent),
+		service.WithAccessRecorder(accessRecorder),
+		service.WithRedirectPolicy(cfg.DefaultRedirect, cfg.RedirectCacheMaxAge),
+		service.WithPasswordThrottle(passwordLimiter),
+		service.WithClickCounter(statsService),
+		service.WithGeoLocator(geoLocator),
+		service.WithUTMTemplates(repository.NewUTMTemplateRepository(db)),
+		service.WithDomains(repository.NewDomainRepository(db)),
+		service.WithStrictDomains(cfg.StrictDomains),
+		service.WithURLValidators(validators...),
+		service.WithShortenerResolver(service.NewShortenerResolver(cfg.Safety.ShortenerHosts, shortenerClient, cfg.Safety.ResolveTimeout)),
+	)
 
 	handlers := api.NewURLHandler(urlService, statsService)
+	if cfg.TemplatesDir != "" {
+		templates, err := api.LoadTemplates(cfg.TemplatesDir)
+		if err != nil {
+			log.Fatalf("Failed to load templates: %v", err)
+		}
+		handlers.SetTemplates(templates)
+	}
+	handlers.SetComingSoonURL(cfg.ComingSoonURL)
+	if err := handlers.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	router.Use(metrics.MetricsMiddleware())
 
@@ -64,10 +159,27 @@ func main() {
 
 	router.POST("/shorten", handlers.ShortenURL)
 	router.GET("/:shortURL", handlers.RedirectToLongURL)
+	router.GET("/:shortURL/*path", handlers.RedirectToLongURL)
+	router.POST("/:shortURL", handlers.UnlockRedirect)
+	router.POST("/:shortURL/*path", handlers.UnlockRedirect)
 	router.GET("/info/:shortURL", handlers.GetURLInfo)
+	router.PATCH("/:shortURL", handlers.UpdateURL)
 	router.DELETE("/:shortURL", handlers.DeleteURL)
 
 	router.GET("/stats/:shortURL", handlers.GetURLStats)
+	router.GET("/qr/:shortURL", handlers.GetQRCode)
+
+	router.GET("/account/utm", handlers.GetUTMTemplate)
+	router.PUT("/account/utm", handlers.SetUTMTemplate)
+	router.DELETE("/account/utm", handlers.DeleteUTMTemplate)
+
+	router.GET("/domains", handlers.ListDomains)
+	router.POST("/domains", handlers.AddDomain)
+	router.DELETE("/domains/:host", handlers.RemoveDomain)
+
+	router.GET("/links", handlers.ListURLs)
+	router.POST("/links/:code/restore", handlers.RestoreURL)
+	router.DELETE("/links/:code", handlers.DeleteLink)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Server.Port,
@@ -91,5 +203,39 @@ func main() {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
+	if err := accessRecorder.Close(ctx); err != nil {
+		log.Printf("Failed to flush access counts: %v", err)
+	}
+
+	if keyPool != nil {
+		if err := keyPool.Close(ctx); err != nil {
+			log.Printf("Failed to release key pool: %v", err)
+		}
+	}
+
 	log.Println("Server exiting")
 }
+
+func newCodeGenerator(cfg config.ShortCodeConfig, seq service.SequenceSource) (service.CodeGenerator, error) {
+	switch cfg.Generator {
+	case "", "random":
+		if cfg.Length < 4 {
+			return nil, fmt.Errorf("short code length must be at least 4, got %d", cfg.Length)
+		}
+		return service.NewRandomCodeGenerator(cfg.Length), nil
+	case "sequence":
+		return service.NewSequenceCodeGenerator(seq), nil
+	case "obfuscated":
+		return service.NewObfuscatedCodeGenerator(seq, cfg.Length, cfg.Secret)
+	default:
+		return nil, fmt.Errorf("unknown short code generator %q", cfg.Generator)
+	}
+}
+
+func processOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kakuzops/ml-url/internal/domain"
+	"github.com/kakuzops/ml-url/internal/service"
+)
+
+type DomainRequest struct {
+	Host string `json:"host" binding:"required"`
+}
+
+type DomainResponse struct {
+	Host      string `json:"host"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newDomainResponse(d domain.ShortDomain) DomainResponse {
+	return DomainResponse{
+		Host:      d.Host,
+		CreatedAt: d.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// ListDomains returns the branded hosts links can be created on, besides the
+// primary domain.
+func (h *URLHandler) ListDomains(c *gin.Context) {
+	domains, err := h.urlService.ListDomains(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]DomainResponse, 0, len(domains))
+	for _, d := range domains {
+		response = append(response, newDomainResponse(d))
+	}
+	c.JSON(http.StatusOK, gin.H{"domains": response})
+}
+
+func (h *URLHandler) AddDomain(c *gin.Context) {
+	var req DomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	shortDomain, err := h.urlService.AddDomain(c.Request.Context(), req.Host)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidDomain):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrDomainTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, newDomainResponse(*shortDomain))
+}
+
+// RemoveDomain stops serving a branded host. Links created on it are kept.
+func (h *URLHandler) RemoveDomain(c *gin.Context) {
+	if err := h.urlService.RemoveDomain(c.Request.Context(), c.Param("host")); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain removed successfully"})
+}
@@ -1,30 +1,166 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kakuzops/ml-url/internal/domain"
 	"github.com/kakuzops/ml-url/internal/metrics"
 	"github.com/kakuzops/ml-url/internal/service"
 )
 
+// OwnerHeader identifies the account a request acts on behalf of.
+const OwnerHeader = "X-Owner-ID"
+
+// VariantCookie remembers the A/B variant a visitor was sent to. It is scoped
+// to the short link's path, so each link keeps its own assignment.
+const VariantCookie = "ab_variant"
+
+const variantCookieMaxAge = 30 * 24 * time.Hour
+
+// PreviewSuffix appended to a short code (/abc+) shows the link's preview
+// page instead of redirecting. Codes never contain it.
+const PreviewSuffix = "+"
+
+// ContinueQuery marks the continue link of a preview page (/abc?continue=1),
+// so a link that shows its preview on every visit is followed, and counted,
+// only then. It is not passed on to the destination.
+const ContinueQuery = "continue=1"
+
 type URLHandler struct {
 	urlService   URLServiceInterface
 	statsService *service.StatsService
+	templates    *template.Template
+
+	comingSoonURL  string
+	trustedProxies []*net.IPNet
 }
 
 func NewURLHandler(urlService URLServiceInterface, statsService *service.StatsService) *URLHandler {
 	return &URLHandler{
 		urlService:   urlService,
 		statsService: statsService,
+		templates:    template.Must(LoadTemplates("")),
 	}
 }
 
+// SetComingSoonURL sends browsers visiting links that are not active yet to
+// url instead of showing the coming soon page.
+func (h *URLHandler) SetComingSoonURL(url string) {
+	h.comingSoonURL = url
+}
+
+// SetTrustedProxies lists the proxy IPs or CIDRs whose X-Forwarded-Proto
+// header is believed, as TRUSTED_PROXIES does for X-Forwarded-For.
+func (h *URLHandler) SetTrustedProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid proxy IP %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy CIDR %q: %w", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	h.trustedProxies = networks
+	return nil
+}
+
+// SetTemplates replaces the landing pages shown to browsers for unknown,
+// expired and deleted links.
+func (h *URLHandler) SetTemplates(templates *template.Template) {
+	h.templates = templates
+}
+
 type ShortenRequest struct {
-	URL string `json:"url" binding:"required,url"`
+	URL          string          `json:"url" binding:"required,url"`
+	Domain       string          `json:"domain"`
+	Alias        string          `json:"alias"`
+	Dedupe       *bool           `json:"dedupe"`
+	ExpiresAt    *time.Time      `json:"expires_at"`
+	TTL          string          `json:"ttl"`
+	NeverExpires bool            `json:"never_expires"`
+	ActivatesAt  *time.Time      `json:"activates_at"`
+	Title        string          `json:"title"`
+	Description  string          `json:"description"`
+	ImageURL     string          `json:"image_url"`
+	RedirectType int             `json:"redirect_type"`
+	Password     string          `json:"password"`
+	MaxClicks    int64           `json:"max_clicks"`
+	Rules        []TargetingRule `json:"rules"`
+	Variants     []Variant       `json:"variants"`
+
+	QueryMerge      string `json:"query_merge"`
+	PathPassthrough bool   `json:"path_passthrough"`
+	UTM             UTM    `json:"utm"`
+	Preview         bool   `json:"preview"`
+}
+
+// TargetingRule sends visitors matching every condition it sets to
+// Destination; rules are tried in order before the link's own URL.
+type TargetingRule struct {
+	OS          string   `json:"os,omitempty"`
+	Device      string   `json:"device,omitempty"`
+	Languages   []string `json:"languages,omitempty"`
+	Countries   []string `json:"countries,omitempty"`
+	TimeFrom    string   `json:"time_from,omitempty"`
+	TimeTo      string   `json:"time_to,omitempty"`
+	Timezone    string   `json:"timezone,omitempty"`
+	Destination string   `json:"destination"`
+}
+
+// Variant is one weighted destination of an A/B split.
+type Variant struct {
+	Name        string `json:"name,omitempty"`
+	Destination string `json:"destination"`
+	Weight      int    `json:"weight"`
+}
+
+type UpdateURLRequest struct {
+	URL          *string          `json:"url" binding:"omitempty,url"`
+	Title        *string          `json:"title"`
+	Description  *string          `json:"description"`
+	ImageURL     *string          `json:"image_url"`
+	RedirectType *int             `json:"redirect_type"`
+	Password     *string          `json:"password"`
+	MaxClicks    *int64           `json:"max_clicks"`
+	Rules        *[]TargetingRule `json:"rules"`
+	Variants     *[]Variant       `json:"variants"`
+	ExpiresAt    *time.Time       `json:"expires_at"`
+	TTL          string           `json:"ttl"`
+	NeverExpires bool             `json:"never_expires"`
+	ActivatesAt  *time.Time       `json:"activates_at"`
+	ActivateNow  bool             `json:"activate_now"`
+
+	QueryMerge      *string `json:"query_merge"`
+	PathPassthrough *bool   `json:"path_passthrough"`
+	UTM             *UTM    `json:"utm"`
+	Preview         *bool   `json:"preview"`
+}
+
+// UnlockRequest carries the password for a protected link, either from the
+// HTML prompt's form or as JSON.
+type UnlockRequest struct {
+	Password string `form:"password" json:"password"`
 }
 
 type ShortenResponse struct {
@@ -32,9 +168,29 @@ type ShortenResponse struct {
 }
 
 type GetURLResponse struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
-	ExpiresAt   string `json:"expires_at,omitempty"`
+	ShortURL     string          `json:"short_url"`
+	Domain       string          `json:"domain,omitempty"`
+	OriginalURL  string          `json:"original_url"`
+	Title        string          `json:"title,omitempty"`
+	Description  string          `json:"description,omitempty"`
+	ImageURL     string          `json:"image_url,omitempty"`
+	RedirectType int             `json:"redirect_type,omitempty"`
+	Protected    bool            `json:"password_protected,omitempty"`
+	MaxClicks    int64           `json:"max_clicks,omitempty"`
+	Rules        []TargetingRule `json:"rules,omitempty"`
+	Variants     []Variant       `json:"variants,omitempty"`
+	ExpiresAt    string          `json:"expires_at,omitempty"`
+	ActivatesAt  string          `json:"activates_at,omitempty"`
+	NeverExpires bool            `json:"never_expires,omitempty"`
+	AccessCount  int64           `json:"access_count"`
+	LastAccessAt string          `json:"last_accessed_at,omitempty"`
+	CreatedAt    string          `json:"created_at,omitempty"`
+	DeletedAt    string          `json:"deleted_at,omitempty"`
+
+	QueryMerge      string `json:"query_merge,omitempty"`
+	PathPassthrough bool   `json:"path_passthrough,omitempty"`
+	UTM             *UTM   `json:"utm,omitempty"`
+	Preview         bool   `json:"preview,omitempty"`
 }
 
 func (h *URLHandler) ShortenURL(c *gin.Context) {
@@ -48,78 +204,611 @@ func (h *URLHandler) ShortenURL(c *gin.Context) {
 		req.URL = "http://" + req.URL
 	}
 
-	url, err := h.urlService.ShortenURL(c.Request.Context(), req.URL)
+	ttl, err := parseTTL(req.TTL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl"})
+		return
+	}
+
+	host := req.Domain
+	if host == "" {
+		// Links shortened through a host that serves none of its own go on
+		// the primary domain.
+		host, err = h.urlService.ResolveHost(c.Request.Context(), c.Request.Host)
+		if err != nil && !errors.Is(err, service.ErrUnknownDomain) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	url, err := h.urlService.ShortenURL(c.Request.Context(), req.URL, domain.ShortenOptions{
+		Domain:       host,
+		Alias:        req.Alias,
+		Owner:        c.GetHeader(OwnerHeader),
+		Dedupe:       req.Dedupe,
+		ExpiresAt:    req.ExpiresAt,
+		TTL:          ttl,
+		NeverExpires: req.NeverExpires,
+		ActivatesAt:  req.ActivatesAt,
+		Title:        req.Title,
+		Description:  req.Description,
+		ImageURL:     req.ImageURL,
+		RedirectType: req.RedirectType,
+		Password:     req.Password,
+		MaxClicks:    req.MaxClicks,
+		Rules:        toDomainRules(req.Rules),
+		Variants:     toDomainVariants(req.Variants),
+
+		QueryMerge:      req.QueryMerge,
+		PathPassthrough: req.PathPassthrough,
+		UTM:             req.UTM.toDomain(),
+		Preview:         req.Preview,
+	})
+	if err != nil {
+		var rejection *service.RejectionError
+		switch {
+		case errors.As(err, &rejection):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "reason": rejection.Reason})
+		case errors.Is(err, service.ErrInvalidAlias), errors.Is(err, service.ErrReservedAlias), errors.Is(err, service.ErrUnknownDomain), isValidationError(err):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrAliasTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrShortCodeExhausted), errors.Is(err, service.ErrKeyPoolEmpty):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusCreated, ShortenResponse{
+	status := http.StatusCreated
+	if url.Existing {
+		status = http.StatusOK
+	}
+
+	c.JSON(status, ShortenResponse{
 		ShortURL: url.ShortURL,
 	})
 }
 
 func (h *URLHandler) GetURLInfo(c *gin.Context) {
-	shortCode := c.Param("shortURL")
+	host, shortCode := h.managedLink(c, "shortURL")
 
-	shortCode = strings.TrimPrefix(shortCode, "http://")
-	shortCode = strings.TrimPrefix(shortCode, "https://")
-	shortCode = strings.TrimPrefix(shortCode, "url.li/")
+	urlInfo, err := h.urlService.GetURLInfo(c.Request.Context(), host, shortCode)
+	if err != nil {
+		h.respondLinkError(c, shortCode, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newGetURLResponse(urlInfo))
+}
 
-	urlInfo, err := h.urlService.GetURLInfo(c.Request.Context(), shortCode)
+// PreviewURL shows a page describing a link instead of following it. It
+// answers /:code+ for every link, and /:code+/path for links forwarding
+// paths; links created with "preview" show the same page, with the
+// destination, on each visit.
+func (h *URLHandler) PreviewURL(c *gin.Context) {
+	host, shortCode, err := h.visitedLink(c)
+	shortCode = strings.TrimSuffix(shortCode, PreviewSuffix)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		h.respondLinkError(c, shortCode, err)
+		return
+	}
+
+	url, err := h.urlService.PreviewURL(c.Request.Context(), host, shortCode, newVisit(c))
+	if err != nil {
+		h.respondLinkError(c, shortCode, err)
+		return
+	}
+
+	// The preview must not give away what a password or a click limit
+	// guards, so those links only show their metadata.
+	page := newPreviewPage(shortCode, url, continueLink(c, shortCode, url.Preview))
+	switch {
+	case url.IsProtected():
+		page.Destination, page.Notice = "", "This link is password protected."
+	case url.HasClickLimit():
+		page.Destination, page.Notice = "", "This link can only be followed a limited number of times."
+	}
+
+	h.respondPreview(c, page)
+}
+
+func (h *URLHandler) UpdateURL(c *gin.Context) {
+	host, shortCode := h.managedLink(c, "shortURL")
+
+	var req UpdateURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL inválida"})
 		return
 	}
 
-	c.JSON(http.StatusOK, GetURLResponse{
-		ShortURL:    urlInfo.ShortURL,
-		OriginalURL: urlInfo.LongURL,
-		ExpiresAt:   urlInfo.ExpiresAt.Format(time.RFC3339),
+	ttl, err := parseTTL(req.TTL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl"})
+		return
+	}
+
+	var rules *[]domain.TargetingRule
+	if req.Rules != nil {
+		converted := toDomainRules(*req.Rules)
+		rules = &converted
+	}
+
+	var utm *domain.UTM
+	if req.UTM != nil {
+		converted := req.UTM.toDomain()
+		utm = &converted
+	}
+
+	var variants *[]domain.Variant
+	if req.Variants != nil {
+		converted := toDomainVariants(*req.Variants)
+		variants = &converted
+	}
+
+	url, err := h.urlService.UpdateURL(c.Request.Context(), host, shortCode, domain.UpdateOptions{
+		Actor:        c.GetHeader(OwnerHeader),
+		LongURL:      req.URL,
+		Title:        req.Title,
+		Description:  req.Description,
+		ImageURL:     req.ImageURL,
+		RedirectType: req.RedirectType,
+		Password:     req.Password,
+		MaxClicks:    req.MaxClicks,
+		Rules:        rules,
+		Variants:     variants,
+		ExpiresAt:    req.ExpiresAt,
+		TTL:          ttl,
+		NeverExpires: req.NeverExpires,
+		ActivatesAt:  req.ActivatesAt,
+		ActivateNow:  req.ActivateNow,
+
+		QueryMerge:      req.QueryMerge,
+		PathPassthrough: req.PathPassthrough,
+		UTM:             utm,
+		Preview:         req.Preview,
 	})
+	if err != nil {
+		var rejection *service.RejectionError
+		switch {
+		case errors.As(err, &rejection):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "reason": rejection.Reason})
+		case isValidationError(err):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.respondLinkError(c, shortCode, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, newGetURLResponse(url))
 }
 
-func (h *URLHandler) RedirectToLongURL(c *gin.Context) {
-	shortCode := c.Param("shortURL")
+func newGetURLResponse(url *domain.URL) GetURLResponse {
+	response := GetURLResponse{
+		ShortURL:     url.ShortURL,
+		Domain:       url.Domain,
+		OriginalURL:  url.LongURL,
+		Title:        url.Title,
+		Description:  url.Description,
+		ImageURL:     url.ImageURL,
+		RedirectType: url.RedirectType,
+		Protected:    url.IsProtected(),
+		MaxClicks:    url.MaxClicks,
+		Rules:        newTargetingRules(url.Rules),
+		Variants:     newVariants(url.Variants),
+		NeverExpires: url.NeverExpires(),
+		AccessCount:  url.AccessCount,
+
+		QueryMerge:      url.QueryMerge,
+		PathPassthrough: url.PathPassthrough,
+		UTM:             newUTM(url.UTM),
+		Preview:         url.Preview,
+	}
+	if url.ExpiresAt != nil {
+		response.ExpiresAt = url.ExpiresAt.Format(time.RFC3339)
+	}
+	if url.ActivatesAt != nil {
+		response.ActivatesAt = url.ActivatesAt.Format(time.RFC3339)
+	}
+	if url.LastAccessedAt != nil {
+		response.LastAccessAt = url.LastAccessedAt.Format(time.RFC3339)
+	}
+	if !url.CreatedAt.IsZero() {
+		response.CreatedAt = url.CreatedAt.Format(time.RFC3339)
+	}
+	if url.DeletedAt.Valid {
+		response.DeletedAt = url.DeletedAt.Time.Format(time.RFC3339)
+	}
+	return response
+}
+
+func toDomainRules(rules []TargetingRule) []domain.TargetingRule {
+	converted := make([]domain.TargetingRule, 0, len(rules))
+	for _, rule := range rules {
+		converted = append(converted, domain.TargetingRule{
+			OS:          rule.OS,
+			Device:      rule.Device,
+			Languages:   strings.Join(rule.Languages, ","),
+			Countries:   strings.Join(rule.Countries, ","),
+			TimeFrom:    rule.TimeFrom,
+			TimeTo:      rule.TimeTo,
+			Timezone:    rule.Timezone,
+			Destination: rule.Destination,
+		})
+	}
+	return converted
+}
+
+func newTargetingRules(rules []domain.TargetingRule) []TargetingRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	converted := make([]TargetingRule, 0, len(rules))
+	for _, rule := range rules {
+		converted = append(converted, TargetingRule{
+			OS:          rule.OS,
+			Device:      rule.Device,
+			Languages:   splitList(rule.Languages),
+			Countries:   splitList(rule.Countries),
+			TimeFrom:    rule.TimeFrom,
+			TimeTo:      rule.TimeTo,
+			Timezone:    rule.Timezone,
+			Destination: rule.Destination,
+		})
+	}
+	return converted
+}
+
+func toDomainVariants(variants []Variant) []domain.Variant {
+	converted := make([]domain.Variant, 0, len(variants))
+	for _, variant := range variants {
+		converted = append(converted, domain.Variant{
+			Name:        variant.Name,
+			Destination: variant.Destination,
+			Weight:      variant.Weight,
+		})
+	}
+	return converted
+}
+
+func newVariants(variants []domain.Variant) []Variant {
+	if len(variants) == 0 {
+		return nil
+	}
+	converted := make([]Variant, 0, len(variants))
+	for _, variant := range variants {
+		converted = append(converted, Variant{
+			Name:        variant.Name,
+			Destination: variant.Destination,
+			Weight:      variant.Weight,
+		})
+	}
+	return converted
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// newVisit collects what the service needs to know about a request to pick
+// and build its destination. Path is the wildcard that follows the code on
+// the /:shortURL/*path routes.
+func newVisit(c *gin.Context) domain.Visit {
+	variant, _ := c.Cookie(VariantCookie)
+	query, confirmed := cutContinue(c.Request.URL.RawQuery)
+	return domain.Visit{
+		UserAgent:      c.Request.UserAgent(),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		ClientIP:       c.ClientIP(),
+		Time:           time.Now(),
+		Variant:        variant,
+		Path:           strings.TrimPrefix(c.Param("path"), "/"),
+		Query:          query,
+		Confirmed:      confirmed,
+	}
+}
+
+// cutContinue removes ContinueQuery from a raw query string and reports
+// whether it was there.
+func cutContinue(rawQuery string) (string, bool) {
+	var kept []string
+	found := false
+	for _, param := range strings.Split(rawQuery, "&") {
+		switch param {
+		case ContinueQuery:
+			found = true
+		case "":
+		default:
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&"), found
+}
+
+// continueLink is where a preview page's continue link leads: the visited
+// link with the path and query that followed it, confirmed with
+// ContinueQuery for links that would otherwise show the preview again.
+func continueLink(c *gin.Context, shortCode string, confirm bool) string {
+	query, _ := cutContinue(c.Request.URL.RawQuery)
+	if confirm {
+		if query != "" {
+			query += "&"
+		}
+		query += ContinueQuery
+	}
+	link := neturl.URL{Path: "/" + shortCode + c.Param("path"), RawQuery: query}
+	return link.String()
+}
+
+// visitedLink returns the domain and code a visitor followed. The domain
+// comes only from the Host header, so a visitor's query string can never
+// point at another domain's links. Hosts that are not registered serve the
+// primary domain's links, or give domain.ErrNotFound with strict domains.
+func (h *URLHandler) visitedLink(c *gin.Context) (host, shortCode string, err error) {
+	host, err = h.urlService.ResolveHost(c.Request.Context(), c.Request.Host)
+	if errors.Is(err, service.ErrUnknownDomain) {
+		err = domain.ErrNotFound
+	}
+	return host, c.Param("shortURL"), err
+}
 
-	shortCode = strings.TrimPrefix(shortCode, "http://")
+// managedLink returns the domain and code a management request addresses.
+// The parameter may be a full short URL (https://go.brand.com/abc), the
+// domain may be named with ?domain=, and otherwise the Host header decides
+// as it does for visits.
+func (h *URLHandler) managedLink(c *gin.Context, param string) (host, shortCode string) {
+	shortCode = strings.TrimPrefix(c.Param(param), "http://")
 	shortCode = strings.TrimPrefix(shortCode, "https://")
-	shortCode = strings.TrimPrefix(shortCode, "url.li/")
+	if prefix, code, found := strings.Cut(shortCode, "/"); found {
+		return prefix, code
+	}
+	if host := c.Query("domain"); host != "" {
+		return host, shortCode
+	}
+	// A host that cannot be resolved is passed on as is; the service finds
+	// no links in its namespace.
+	host, err := h.urlService.ResolveHost(c.Request.Context(), c.Request.Host)
+	if err != nil {
+		return c.Request.Host, shortCode
+	}
+	return host, shortCode
+}
+
+func parseTTL(ttl string) (time.Duration, error) {
+	if ttl == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(ttl)
+}
+
+func isValidationError(err error) bool {
+	return errors.Is(err, service.ErrInvalidExpiration) ||
+		errors.Is(err, service.ErrInvalidActivation) ||
+		errors.Is(err, service.ErrInvalidRedirectType) ||
+		errors.Is(err, service.ErrPermanentNotAllowed) ||
+		errors.Is(err, service.ErrTitleTooLong) ||
+		errors.Is(err, service.ErrPasswordTooLong) ||
+		errors.Is(err, service.ErrInvalidMaxClicks) ||
+		errors.Is(err, service.ErrInvalidRule) ||
+		errors.Is(err, service.ErrInvalidVariant) ||
+		errors.Is(err, service.ErrInvalidQueryMerge) ||
+		errors.Is(err, service.ErrInvalidUTM) ||
+		errors.Is(err, service.ErrInvalidImageURL)
+}
+
+func (h *URLHandler) RedirectToLongURL(c *gin.Context) {
+	if strings.HasSuffix(c.Param("shortURL"), PreviewSuffix) {
+		h.PreviewURL(c)
+		return
+	}
 
-	longURL, err := h.urlService.GetLongURL(c.Request.Context(), shortCode)
+	host, shortCode, err := h.visitedLink(c)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		h.respondLinkError(c, shortCode, err)
 		return
 	}
 
-	if err := h.statsService.IncrementAccess(shortCode, longURL); err != nil {
-		c.Error(err)
+	if service.IsUnfurler(c.Request.UserAgent()) && h.respondCard(c, host, shortCode) {
+		return
 	}
 
-	metrics.UrlAccessCount.WithLabelValues(shortCode, longURL).Inc()
+	redirect, err := h.urlService.ResolveRedirect(c.Request.Context(), host, shortCode, newVisit(c))
+	if err != nil {
+		if errors.Is(err, service.ErrPasswordRequired) {
+			h.respondPasswordPrompt(c, shortCode, err)
+			return
+		}
+		h.respondLinkError(c, shortCode, err)
+		return
+	}
+
+	h.followRedirect(c, shortCode, redirect)
+}
+
+// UnlockRedirect checks the password posted from the prompt and redirects
+// with 303 See Other, so the browser follows it with a GET and the password
+// is never re-sent to the destination.
+func (h *URLHandler) UnlockRedirect(c *gin.Context) {
+	host, shortCode, err := h.visitedLink(c)
+	if err != nil {
+		h.respondLinkError(c, shortCode, err)
+		return
+	}
+
+	var req UnlockRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	redirect, err := h.urlService.UnlockRedirect(c.Request.Context(), host, shortCode, req.Password, newVisit(c))
+	if err != nil {
+		if errors.Is(err, service.ErrWrongPassword) || errors.Is(err, service.ErrTooManyAttempts) {
+			h.respondPasswordPrompt(c, shortCode, err)
+			return
+		}
+		h.respondLinkError(c, shortCode, err)
+		return
+	}
+
+	redirect.StatusCode = http.StatusSeeOther
+	redirect.CacheMaxAge = 0
+	h.followRedirect(c, shortCode, redirect)
+}
+
+func (h *URLHandler) followRedirect(c *gin.Context, shortCode string, redirect *domain.Redirect) {
+	longURL := redirect.Location
+
+	if redirect.Variant != "" {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(VariantCookie, redirect.Variant, int(variantCookieMaxAge.Seconds()), "/"+shortCode, "", h.isHTTPS(c), true)
+	}
 
 	if !strings.HasPrefix(longURL, "http://") && !strings.HasPrefix(longURL, "https://") {
 		longURL = "http://" + longURL
 	}
 
-	c.Redirect(http.StatusMovedPermanently, longURL)
+	// Nothing is counted until the visitor continues from the preview. The
+	// variant cookie is already set, so they get the destination shown.
+	if redirect.Preview {
+		page := newPreviewPage(shortCode, redirect.URL, continueLink(c, shortCode, true))
+		page.Destination = longURL
+		h.respondPreview(c, page)
+		return
+	}
+
+	// Stats and metrics are keyed by the destination without the visitor's
+	// path and query, which would otherwise make every visit a new series.
+	key := domain.LinkKey(redirect.URL.Domain, shortCode)
+	if err := h.statsService.IncrementAccess(key, redirect.Destination, redirect.Variant); err != nil {
+		c.Error(err)
+	}
+
+	metrics.UrlAccessCount.WithLabelValues(key, redirect.Destination).Inc()
+
+	if redirect.CacheMaxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(redirect.CacheMaxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", "private, no-cache, no-store, must-revalidate")
+	}
+
+	c.Redirect(redirect.StatusCode, longURL)
 }
 
-func (h *URLHandler) DeleteURL(c *gin.Context) {
-	shortCode := c.Param("shortURL")
+// isHTTPS reports whether the visitor reached the service over HTTPS, either
+// directly or through a trusted proxy that terminated TLS. X-Forwarded-Proto
+// from anyone else is ignored, as clients can send it themselves.
+func (h *URLHandler) isHTTPS(c *gin.Context) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	if !strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		return false
+	}
+	remote := net.ParseIP(c.RemoteIP())
+	for _, network := range h.trustedProxies {
+		if remote != nil && network.Contains(remote) {
+			return true
+		}
+	}
+	return false
+}
 
-	shortCode = strings.TrimPrefix(shortCode, "http://")
-	shortCode = strings.TrimPrefix(shortCode, "https://")
-	shortCode = strings.TrimPrefix(shortCode, "url.li/")
+func (h *URLHandler) DeleteURL(c *gin.Context) {
+	host, shortCode := h.managedLink(c, "shortURL")
 
-	if err := h.urlService.DeleteURL(c.Request.Context(), shortCode); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	if err := h.urlService.DeleteURL(c.Request.Context(), host, shortCode); err != nil {
+		h.respondLinkError(c, shortCode, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "URL deleted successfully"})
 }
 
+func (h *URLHandler) ListURLs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	filter := domain.ListFilter{
+		Deleted: c.Query("deleted") == "true",
+		Limit:   limit,
+		Offset:  offset,
+	}
+	if owner := c.GetHeader(OwnerHeader); owner != "" {
+		filter.Owner = &owner
+	}
+
+	urls, err := h.urlService.ListURLs(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	links := make([]GetURLResponse, 0, len(urls))
+	for _, url := range urls {
+		links = append(links, newGetURLResponse(url))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"links": links,
+	})
+}
+
+func (h *URLHandler) RestoreURL(c *gin.Context) {
+	host, shortCode := h.managedLink(c, "code")
+
+	if err := h.urlService.RestoreURL(c.Request.Context(), host, shortCode); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deleted URL not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "URL restored successfully"})
+}
+
+// DeleteLink soft deletes a link, or removes it permanently with ?purge=true.
+func (h *URLHandler) DeleteLink(c *gin.Context) {
+	host, shortCode := h.managedLink(c, "code")
+
+	if c.Query("purge") != "true" {
+		if err := h.urlService.DeleteURL(c.Request.Context(), host, shortCode); err != nil {
+			h.respondLinkError(c, shortCode, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "URL deleted successfully"})
+		return
+	}
+
+	if err := h.urlService.PurgeURL(c.Request.Context(), host, shortCode); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "URL purged successfully"})
+}
+
 func (h *URLHandler) GetTopURLs(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "10")
 	limit, err := strconv.Atoi(limitStr)
@@ -143,13 +832,19 @@ func (h *URLHandler) GetTopURLs(c *gin.Context) {
 }
 
 func (h *URLHandler) GetURLStats(c *gin.Context) {
-	shortCode := c.Param("shortURL")
+	host, shortCode := h.managedLink(c, "shortURL")
 
-	shortCode = strings.TrimPrefix(shortCode, "http://")
-	shortCode = strings.TrimPrefix(shortCode, "https://")
-	shortCode = strings.TrimPrefix(shortCode, "url.li/")
+	host, err := h.urlService.ResolveHost(c.Request.Context(), host)
+	if errors.Is(err, service.ErrUnknownDomain) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	stats, err := h.statsService.GetURLStats(shortCode)
+	stats, err := h.statsService.GetURLStats(domain.LinkKey(host, shortCode))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
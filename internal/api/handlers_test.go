@@ -2,59 +2,324 @@ package api
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kakuzops/ml-url/internal/domain"
+	"github.com/kakuzops/ml-url/internal/service"
+	"github.com/redis/go-redis/v9"
 )
 
 type mockURLService struct {
-	urls map[string]*domain.URL
+	urls         map[string]*domain.URL
+	deleted      map[string]*domain.URL
+	utmTemplates map[string]*domain.UTMTemplate
+	domains      map[string]domain.ShortDomain
+	lastVisit    domain.Visit
+	// strictDomains mirrors service.WithStrictDomains.
+	strictDomains bool
 }
 
 func newMockURLService() *mockURLService {
 	return &mockURLService{
-		urls: make(map[string]*domain.URL),
+		urls:         make(map[string]*domain.URL),
+		deleted:      make(map[string]*domain.URL),
+		utmTemplates: make(map[string]*domain.UTMTemplate),
+		domains:      make(map[string]domain.ShortDomain),
 	}
 }
 
-func (m *mockURLService) ShortenURL(ctx context.Context, longURL string) (*domain.URL, error) {
+// key mirrors the service: links live in the namespace of the host they are
+// addressed through, "" for the primary one.
+func (m *mockURLService) key(host, shortCode string) string {
+	return domain.LinkKey(mockNamespace(host), shortCode)
+}
+
+// mockNamespace treats url.li and example.com, the Host of httptest
+// requests, as the primary domain.
+func mockNamespace(host string) string {
+	host, _, _ = strings.Cut(strings.ToLower(host), ":")
+	if host == "url.li" || host == "example.com" {
+		return ""
+	}
+	return host
+}
+
+func (m *mockURLService) ShortenURL(ctx context.Context, longURL string, opts domain.ShortenOptions) (*domain.URL, error) {
+	linkDomain := mockNamespace(opts.Domain)
+	if _, exists := m.domains[linkDomain]; !exists && linkDomain != "" {
+		return nil, service.ErrUnknownDomain
+	}
+	if err := checkDestination(ctx, longURL); err != nil {
+		return nil, err
+	}
+	shortCode := "testshort"
+	if opts.Alias != "" {
+		if opts.Alias == "shorten" {
+			return nil, service.ErrReservedAlias
+		}
+		if _, exists := m.urls[m.key(opts.Domain, opts.Alias)]; exists {
+			return nil, service.ErrAliasTaken
+		}
+		shortCode = opts.Alias
+	}
+	expiresAt := time.Now().Add(24 * time.Hour)
 	url := &domain.URL{
-		LongURL:   longURL,
-		ShortURL:  "testshort",
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+		LongURL:         longURL,
+		ShortURL:        shortCode,
+		Domain:          linkDomain,
+		RedirectType:    opts.RedirectType,
+		PasswordHash:    opts.Password,
+		MaxClicks:       opts.MaxClicks,
+		Variants:        opts.Variants,
+		Preview:         opts.Preview,
+		PathPassthrough: opts.PathPassthrough,
+		Title:           opts.Title,
+		Description:     opts.Description,
+		ImageURL:        opts.ImageURL,
+		CreatedAt:       time.Now(),
+		ExpiresAt:       &expiresAt,
+	}
+	m.urls[domain.LinkKey(url.Domain, url.ShortURL)] = url
+	return url, nil
+}
+
+func (m *mockURLService) ResolveRedirect(ctx context.Context, host, shortCode string, visit domain.Visit) (*domain.Redirect, error) {
+	m.lastVisit = visit
+	url, err := m.GetURLInfo(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if !url.IsActive(time.Now()) {
+		return nil, &domain.NotActiveError{ActivatesAt: *url.ActivatesAt}
+	}
+	if visit.Path != "" && !url.PathPassthrough {
+		return nil, domain.ErrNotFound
+	}
+	if url.IsProtected() {
+		return nil, service.ErrPasswordRequired
+	}
+	if url.HasClickLimit() && url.AccessCount >= url.MaxClicks {
+		return nil, domain.ErrExhausted
+	}
+	redirect := m.redirectTo(url)
+	if len(url.Variants) > 0 {
+		redirect.Location, redirect.Destination, redirect.Variant = url.Variants[0].Destination, url.Variants[0].Destination, url.Variants[0].Name
+	}
+	redirect.Preview = url.Preview && !visit.Confirmed
+	return redirect, nil
+}
+
+func (m *mockURLService) UnlockRedirect(ctx context.Context, host, shortCode, password string, visit domain.Visit) (*domain.Redirect, error) {
+	if shortCode == "locked" {
+		return nil, service.ErrTooManyAttempts
+	}
+	url, err := m.GetURLInfo(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if url.PasswordHash != password {
+		return nil, service.ErrWrongPassword
+	}
+	return m.redirectTo(url), nil
+}
+
+func (m *mockURLService) redirectTo(url *domain.URL) *domain.Redirect {
+	redirect := &domain.Redirect{URL: url, Location: url.LongURL, Destination: url.LongURL, StatusCode: http.StatusFound}
+	if url.RedirectType != 0 {
+		redirect.StatusCode = url.RedirectType
+	}
+	if redirect.StatusCode == http.StatusPermanentRedirect {
+		redirect.CacheMaxAge = time.Hour
+	}
+	return redirect
+}
+
+func (m *mockURLService) GetURLInfo(ctx context.Context, host, shortCode string) (*domain.URL, error) {
+	url, exists := m.urls[m.key(host, shortCode)]
+	if !exists {
+		if _, deleted := m.deleted[m.key(host, shortCode)]; deleted {
+			return nil, domain.ErrDeleted
+		}
+		return nil, domain.ErrNotFound
+	}
+	if url.IsExpired(time.Now()) {
+		return nil, domain.ErrExpired
+	}
+	return url, nil
+}
+
+func (m *mockURLService) PreviewURL(ctx context.Context, host, shortCode string, visit domain.Visit) (*domain.URL, error) {
+	m.lastVisit = visit
+	url, err := m.GetURLInfo(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if !url.IsActive(time.Now()) {
+		return nil, &domain.NotActiveError{ActivatesAt: *url.ActivatesAt}
+	}
+	if visit.Path != "" && !url.PathPassthrough {
+		return nil, domain.ErrNotFound
+	}
+	if url.HasClickLimit() && url.AccessCount >= url.MaxClicks {
+		return nil, domain.ErrExhausted
+	}
+	return url, nil
+}
+
+func (m *mockURLService) UpdateURL(ctx context.Context, host, shortCode string, opts domain.UpdateOptions) (*domain.URL, error) {
+	url, exists := m.urls[m.key(host, shortCode)]
+	if !exists {
+		return nil, domain.ErrNotFound
+	}
+	if opts.TTL < 0 {
+		return nil, service.ErrInvalidExpiration
+	}
+	if opts.LongURL != nil {
+		if err := checkDestination(ctx, *opts.LongURL); err != nil {
+			return nil, err
+		}
+		url.LongURL = *opts.LongURL
 	}
-	m.urls[url.ShortURL] = url
 	return url, nil
 }
 
-func (m *mockURLService) GetLongURL(ctx context.Context, shortCode string) (string, error) {
-	if url, exists := m.urls[shortCode]; exists {
-		return url.LongURL, nil
+// checkDestination applies the service's heuristics, so tests can get a
+// rejection with an IP address or credentials in the long URL.
+func checkDestination(ctx context.Context, longURL string) error {
+	parsed, err := neturl.Parse(longURL)
+	if err != nil {
+		return err
+	}
+	return service.HeuristicValidator{}.Validate(ctx, parsed)
+}
+
+func (m *mockURLService) DeleteURL(ctx context.Context, host, shortCode string) error {
+	if _, err := m.GetURLInfo(ctx, host, shortCode); err != nil {
+		return err
+	}
+	key := m.key(host, shortCode)
+	m.deleted[key] = m.urls[key]
+	delete(m.urls, key)
+	return nil
+}
+
+func (m *mockURLService) ListURLs(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	source := m.urls
+	if filter.Deleted {
+		source = m.deleted
+	}
+	var urls []*domain.URL
+	for _, url := range source {
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+func (m *mockURLService) RestoreURL(ctx context.Context, host, shortCode string) error {
+	key := m.key(host, shortCode)
+	url, exists := m.deleted[key]
+	if !exists {
+		return domain.ErrNotFound
+	}
+	delete(m.deleted, key)
+	m.urls[key] = url
+	return nil
+}
+
+func (m *mockURLService) PurgeURL(ctx context.Context, host, shortCode string) error {
+	key := m.key(host, shortCode)
+	_, active := m.urls[key]
+	_, deleted := m.deleted[key]
+	if !active && !deleted {
+		return domain.ErrNotFound
 	}
-	return "", fmt.Errorf("URL not found")
+	delete(m.urls, key)
+	delete(m.deleted, key)
+	return nil
+}
+
+func (m *mockURLService) GetUTMTemplate(ctx context.Context, owner string) (*domain.UTMTemplate, error) {
+	template, exists := m.utmTemplates[owner]
+	if !exists {
+		return nil, domain.ErrNotFound
+	}
+	return template, nil
 }
 
-func (m *mockURLService) GetURLInfo(ctx context.Context, shortCode string) (*domain.URL, error) {
-	if url, exists := m.urls[shortCode]; exists {
-		return url, nil
+func (m *mockURLService) SaveUTMTemplate(ctx context.Context, owner string, utm domain.UTM) (*domain.UTMTemplate, error) {
+	if len(utm.Source) > 255 {
+		return nil, service.ErrInvalidUTM
 	}
-	return nil, fmt.Errorf("URL not found")
+	template := &domain.UTMTemplate{Owner: owner, UTM: utm, UpdatedAt: time.Now()}
+	m.utmTemplates[owner] = template
+	return template, nil
 }
 
-func (m *mockURLService) DeleteURL(ctx context.Context, shortCode string) error {
-	if _, exists := m.urls[shortCode]; !exists {
-		return fmt.Errorf("URL not found")
+func (m *mockURLService) DeleteUTMTemplate(ctx context.Context, owner string) error {
+	if _, exists := m.utmTemplates[owner]; !exists {
+		return domain.ErrNotFound
 	}
-	delete(m.urls, shortCode)
+	delete(m.utmTemplates, owner)
 	return nil
 }
 
+func (m *mockURLService) ResolveHost(ctx context.Context, host string) (string, error) {
+	host = mockNamespace(host)
+	if _, exists := m.domains[host]; !exists && host != "" {
+		if m.strictDomains {
+			return "", service.ErrUnknownDomain
+		}
+		return "", nil
+	}
+	return host, nil
+}
+
+func (m *mockURLService) ListDomains(ctx context.Context) ([]domain.ShortDomain, error) {
+	var domains []domain.ShortDomain
+	for _, d := range m.domains {
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+func (m *mockURLService) AddDomain(ctx context.Context, host string) (*domain.ShortDomain, error) {
+	if !strings.Contains(host, ".") {
+		return nil, service.ErrInvalidDomain
+	}
+	if _, exists := m.domains[host]; exists {
+		return nil, domain.ErrDomainTaken
+	}
+	shortDomain := domain.ShortDomain{Host: host, CreatedAt: time.Now()}
+	m.domains[host] = shortDomain
+	return &shortDomain, nil
+}
+
+func (m *mockURLService) RemoveDomain(ctx context.Context, host string) error {
+	if _, exists := m.domains[host]; !exists {
+		return domain.ErrNotFound
+	}
+	delete(m.domains, host)
+	return nil
+}
+
+// newTestStatsService points at an unreachable Redis so stats failures are
+// reported through c.Error without slowing tests down.
+func newTestStatsService() *service.StatsService {
+	return service.NewStatsService(redis.NewClient(&redis.Options{
+		Addr:       "127.0.0.1:1",
+		MaxRetries: -1,
+	}))
+}
+
 func TestDeleteURL(t *testing.T) {
 
 	gin.SetMode(gin.TestMode)
@@ -65,7 +330,7 @@ func TestDeleteURL(t *testing.T) {
 	router.DELETE("/:shortURL", handler.DeleteURL)
 
 	t.Run("Delete existing URL", func(t *testing.T) {
-		url, _ := mockService.ShortenURL(context.Background(), "https://www.example.com")
+		url, _ := mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{})
 		shortCode := url.ShortURL
 
 		req := httptest.NewRequest("DELETE", "/"+shortCode, nil)
@@ -87,3 +352,961 @@ func TestDeleteURL(t *testing.T) {
 		}
 	})
 }
+
+func TestShortenURLWithAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, nil)
+	router := gin.New()
+	router.POST("/shorten", handler.ShortenURL)
+
+	shorten := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Create alias", func(t *testing.T) {
+		w := shorten(`{"url": "https://www.example.com", "alias": "black-friday"}`)
+		if w.Code != http.StatusCreated {
+			t.Errorf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	})
+
+	t.Run("Alias already taken", func(t *testing.T) {
+		w := shorten(`{"url": "https://www.example.com", "alias": "black-friday"}`)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+		}
+	})
+
+	t.Run("Reserved alias", func(t *testing.T) {
+		w := shorten(`{"url": "https://www.example.com", "alias": "shorten"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestUpdateURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, nil)
+	router := gin.New()
+	router.PATCH("/:shortURL", handler.UpdateURL)
+
+	mockService.ShortenURL(context.Background(), "https://www.exmaple.com", domain.ShortenOptions{})
+
+	update := func(shortCode, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/"+shortCode, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Update destination", func(t *testing.T) {
+		w := update("testshort", `{"url": "https://www.example.com"}`)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "https://www.example.com") {
+			t.Errorf("Expected updated destination in response, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("Invalid destination", func(t *testing.T) {
+		w := update("testshort", `{"url": "not a url"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Invalid expiration", func(t *testing.T) {
+		w := update("testshort", `{"ttl": "-1h"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Update non-existing URL", func(t *testing.T) {
+		w := update("naoexiste", `{"url": "https://www.example.com"}`)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestRedirectToLongURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, newTestStatsService())
+	router := gin.New()
+	router.GET("/:shortURL", handler.RedirectToLongURL)
+	router.GET("/:shortURL/*path", handler.RedirectToLongURL)
+
+	mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "temporary"})
+	mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "permanent", RedirectType: http.StatusPermanentRedirect})
+
+	t.Run("Default redirect is not cached", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/temporary", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusFound, w.Code)
+		}
+		if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "no-store") {
+			t.Errorf("Expected non-cacheable redirect, got Cache-Control %q", cc)
+		}
+	})
+
+	t.Run("Visitor details reach the service", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/temporary", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)")
+		req.Header.Set("Accept-Language", "pt-BR,pt;q=0.9")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		visit := mockService.lastVisit
+		if visit.UserAgent != "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)" || visit.AcceptLanguage != "pt-BR,pt;q=0.9" {
+			t.Errorf("Expected User-Agent and Accept-Language in visit, got %+v", visit)
+		}
+		if visit.Time.IsZero() {
+			t.Error("Expected visit time to be set")
+		}
+	})
+
+	t.Run("Variant is remembered in a cookie", func(t *testing.T) {
+		mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{
+			Alias:    "split",
+			Variants: []domain.Variant{{Name: "B", Destination: "https://www.example.com/b", Weight: 1}},
+		})
+
+		req := httptest.NewRequest("GET", "/split", nil)
+		req.AddCookie(&http.Cookie{Name: VariantCookie, Value: "A"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if mockService.lastVisit.Variant != "A" {
+			t.Errorf("Expected variant A from cookie in visit, got %q", mockService.lastVisit.Variant)
+		}
+		if location := w.Header().Get("Location"); location != "https://www.example.com/b" {
+			t.Errorf("Expected Location https://www.example.com/b, got %s", location)
+		}
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != VariantCookie || cookies[0].Value != "B" || cookies[0].Path != "/split" {
+			t.Errorf("Expected variant cookie B scoped to /split, got %+v", cookies)
+		}
+	})
+
+	t.Run("Variant cookie is secure over HTTPS", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/split", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Secure {
+			t.Errorf("Expected a non-secure variant cookie over HTTP, got %+v", cookies)
+		}
+
+		req = httptest.NewRequest("GET", "/split", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Secure {
+			t.Errorf("Expected X-Forwarded-Proto from an untrusted client to be ignored, got %+v", cookies)
+		}
+
+		if err := handler.SetTrustedProxies([]string{"proxy.internal"}); err == nil {
+			t.Error("Expected an error for a proxy that is neither an IP nor a CIDR")
+		}
+		if err := handler.SetTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}); err != nil {
+			t.Fatalf("Unexpected error setting trusted proxies: %v", err)
+		}
+		defer handler.SetTrustedProxies(nil)
+
+		req = httptest.NewRequest("GET", "/split", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || !cookies[0].Secure {
+			t.Errorf("Expected a secure variant cookie behind a trusted HTTPS proxy, got %+v", cookies)
+		}
+
+		req = httptest.NewRequest("GET", "https://url.li/split", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || !cookies[0].Secure {
+			t.Errorf("Expected a secure variant cookie over TLS, got %+v", cookies)
+		}
+	})
+
+	t.Run("Redirect without variant sets no cookie", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/temporary", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if cookies := w.Result().Cookies(); len(cookies) != 0 {
+			t.Errorf("Expected no cookies, got %+v", cookies)
+		}
+	})
+
+	t.Run("Trailing path and query reach the service", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/temporary/guide/intro?utm_source=x", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		visit := mockService.lastVisit
+		if visit.Path != "guide/intro" || visit.Query != "utm_source=x" {
+			t.Errorf("Expected path guide/intro and query utm_source=x, got %q and %q", visit.Path, visit.Query)
+		}
+	})
+
+	t.Run("Permanent redirect is cacheable", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/permanent", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusPermanentRedirect {
+			t.Errorf("Expected status code %d, got %d", http.StatusPermanentRedirect, w.Code)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+			t.Errorf("Expected cacheable redirect, got Cache-Control %q", cc)
+		}
+		if location := w.Header().Get("Location"); location != "https://www.example.com" {
+			t.Errorf("Expected Location https://www.example.com, got %s", location)
+		}
+	})
+}
+
+func TestRedirectUnavailableLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, newTestStatsService())
+	router := gin.New()
+	router.GET("/:shortURL", handler.RedirectToLongURL)
+
+	expiresAt := time.Now().Add(-time.Hour)
+	mockService.urls["expired"] = &domain.URL{LongURL: "https://www.example.com", ShortURL: "expired", ExpiresAt: &expiresAt}
+	mockService.deleted["deleted"] = &domain.URL{LongURL: "https://www.example.com", ShortURL: "deleted"}
+	mockService.urls["exhausted"] = &domain.URL{LongURL: "https://www.example.com", ShortURL: "exhausted", MaxClicks: 1, AccessCount: 1}
+	activatesAt := time.Now().Add(time.Hour)
+	mockService.urls["scheduled"] = &domain.URL{LongURL: "https://www.example.com", ShortURL: "scheduled", ActivatesAt: &activatesAt}
+
+	tests := []struct {
+		code   string
+		status int
+	}{
+		{"unknown", http.StatusNotFound},
+		{"expired", http.StatusGone},
+		{"deleted", http.StatusGone},
+		{"exhausted", http.StatusGone},
+		{"scheduled", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code+" as JSON", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tt.code, nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status code %d, got %d", tt.status, w.Code)
+			}
+			var body LinkError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected JSON body, got %q", w.Body.String())
+			}
+			if want := map[string]string{"unknown": "not_found", "expired": "expired", "deleted": "deleted", "exhausted": "exhausted", "scheduled": "not_active"}[tt.code]; body.Code != want {
+				t.Errorf("Expected code %q, got %q", want, body.Code)
+			}
+			if tt.code == "scheduled" && body.ActivatesAt != activatesAt.Format(time.RFC3339) {
+				t.Errorf("Expected activates_at %s, got %q", activatesAt.Format(time.RFC3339), body.ActivatesAt)
+			}
+		})
+
+		t.Run(tt.code+" as HTML", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tt.code, nil)
+			req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status code %d, got %d", tt.status, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("Expected HTML landing page, got Content-Type %q", ct)
+			}
+		})
+	}
+
+	t.Run("Coming soon URL", func(t *testing.T) {
+		handler.SetComingSoonURL("https://www.example.com/soon")
+		defer handler.SetComingSoonURL("")
+
+		req := httptest.NewRequest("GET", "/scheduled", nil)
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "https://www.example.com/soon" {
+			t.Errorf("Expected redirect to the coming soon URL, got %d %s", w.Code, w.Header().Get("Location"))
+		}
+	})
+
+	t.Run("Custom template", func(t *testing.T) {
+		dir := t.TempDir()
+		page := `<p>{{.ShortCode}} is gone for good</p>`
+		if err := os.WriteFile(filepath.Join(dir, "expired.html"), []byte(page), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		templates, err := LoadTemplates(dir)
+		if err != nil {
+			t.Fatalf("Unexpected error loading templates: %v", err)
+		}
+		handler.SetTemplates(templates)
+
+		req := httptest.NewRequest("GET", "/expired", nil)
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if body := w.Body.String(); body != "<p>expired is gone for good</p>" {
+			t.Errorf("Expected custom expired page, got %q", body)
+		}
+
+		req = httptest.NewRequest("GET", "/deleted", nil)
+		req.Header.Set("Accept", "text/html")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if !strings.Contains(w.Body.String(), "Link removed") {
+			t.Errorf("Expected built-in page for codes without a custom template, got %q", w.Body.String())
+		}
+	})
+}
+
+func TestPasswordProtectedRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, newTestStatsService())
+	router := gin.New()
+	router.GET("/:shortURL", handler.RedirectToLongURL)
+	router.POST("/:shortURL", handler.UnlockRedirect)
+
+	mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{
+		Alias:        "secret",
+		Password:     "hunter2",
+		RedirectType: http.StatusPermanentRedirect,
+	})
+	mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "locked", Password: "hunter2"})
+
+	t.Run("Browser gets a password prompt", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/secret", nil)
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `<form method="post">`) {
+			t.Errorf("Expected password form, got %q", w.Body.String())
+		}
+		if location := w.Header().Get("Location"); location != "" {
+			t.Errorf("Expected no redirect before the password is given, got %s", location)
+		}
+	})
+
+	t.Run("API client gets a JSON error", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/secret", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var body LinkError
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusUnauthorized || body.Code != "password_required" {
+			t.Errorf("Expected 401 password_required, got %d %q", w.Code, body.Code)
+		}
+	})
+
+	t.Run("Wrong password shows the prompt again", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/secret", strings.NewReader("password=wrong"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "Incorrect password.") {
+			t.Errorf("Expected error message in prompt, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("Correct password redirects with See Other", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/secret", strings.NewReader("password=hunter2"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("Expected status code %d, got %d", http.StatusSeeOther, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != "https://www.example.com" {
+			t.Errorf("Expected Location https://www.example.com, got %s", location)
+		}
+		if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "no-store") {
+			t.Errorf("Expected unlocked redirect not to be cached, got Cache-Control %q", cc)
+		}
+	})
+
+	t.Run("Throttled code answers 429", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/locked", strings.NewReader(`{"password":"hunter2"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, w.Code)
+		}
+	})
+}
+
+func TestSoftDeleteEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, nil)
+	router := gin.New()
+	router.GET("/links", handler.ListURLs)
+	router.POST("/links/:code/restore", handler.RestoreURL)
+	router.DELETE("/links/:code", handler.DeleteLink)
+
+	mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "promo"})
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("DELETE", "/links/promo"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d on soft delete, got %d", http.StatusOK, w.Code)
+	}
+
+	w := do("GET", "/links?deleted=true")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "promo") {
+		t.Errorf("Expected deleted link in listing, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do("POST", "/links/promo/restore"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d on restore, got %d", http.StatusOK, w.Code)
+	}
+	if w := do("POST", "/links/promo/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d restoring an active link, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if w := do("DELETE", "/links/promo?purge=true"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d on purge, got %d", http.StatusOK, w.Code)
+	}
+	if w := do("DELETE", "/links/promo?purge=true"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d purging a missing link, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestUTMTemplateEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, nil)
+	router := gin.New()
+	router.GET("/account/utm", handler.GetUTMTemplate)
+	router.PUT("/account/utm", handler.SetUTMTemplate)
+	router.DELETE("/account/utm", handler.DeleteUTMTemplate)
+
+	do := func(method, body, owner string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/account/utm", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if owner != "" {
+			req.Header.Set(OwnerHeader, owner)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("GET", "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without owner, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := do("GET", "", "acme"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d before a template is set, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := do("PUT", `{"source": "newsletter", "medium": "email", "campaign": "{code}"}`, "acme")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = do("GET", "", "acme")
+	var response UTMTemplateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Owner != "acme" || response.UTM.Source != "newsletter" || response.UTM.Campaign != "{code}" {
+		t.Errorf("Unexpected template: %+v", response)
+	}
+
+	if w := do("PUT", `{"source": "`+strings.Repeat("x", 256)+`"}`, "acme"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a too long value, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if w := do("DELETE", "", "acme"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d on delete, got %d", http.StatusOK, w.Code)
+	}
+	if w := do("DELETE", "", "acme"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d deleting a missing template, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestDomainEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, nil)
+	router := gin.New()
+	router.GET("/domains", handler.ListDomains)
+	router.POST("/domains", handler.AddDomain)
+	router.DELETE("/domains/:host", handler.RemoveDomain)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/domains", `{"host": "go.brand.com"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w := do("POST", "/domains", `{"host": "go.brand.com"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for a registered domain, got %d", http.StatusConflict, w.Code)
+	}
+	if w := do("POST", "/domains", `{"host": "localhost"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid domain, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := do("GET", "/domains", "")
+	var response struct {
+		Domains []DomainResponse `json:"domains"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Domains) != 1 || response.Domains[0].Host != "go.brand.com" {
+		t.Errorf("Unexpected domains: %+v", response.Domains)
+	}
+
+	if w := do("DELETE", "/domains/go.brand.com", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d on delete, got %d", http.StatusOK, w.Code)
+	}
+	if w := do("DELETE", "/domains/go.brand.com", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d deleting a missing domain, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestBrandedDomainLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.AddDomain(context.Background(), "go.brand.com")
+	handler := NewURLHandler(mockService, newTestStatsService())
+	router := gin.New()
+	router.POST("/shorten", handler.ShortenURL)
+	router.GET("/:shortURL", handler.RedirectToLongURL)
+	router.GET("/info/:shortURL", handler.GetURLInfo)
+
+	do := func(method, host, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "url.li", "/shorten", `{"url": "https://www.example.com", "alias": "promo"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w := do("POST", "go.brand.com", "/shorten", `{"url": "https://brand.example.com", "alias": "promo"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the same alias to be free on another domain, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "url.li", "/shorten", `{"url": "https://www.example.com", "domain": "unknown.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unregistered domain, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	tests := []struct {
+		name     string
+		host     string
+		location string
+	}{
+		{"Primary domain", "url.li", "https://www.example.com"},
+		{"Branded domain", "go.brand.com", "https://brand.example.com"},
+		{"Branded domain with port", "GO.BRAND.COM:8080", "https://brand.example.com"},
+		{"Unregistered host falls back to primary", "10.0.0.1:8080", "https://www.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do("GET", tt.host, "/promo", "")
+			if w.Code != http.StatusFound {
+				t.Fatalf("Expected status code %d, got %d", http.StatusFound, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != tt.location {
+				t.Errorf("Expected Location %s, got %s", tt.location, location)
+			}
+		})
+	}
+
+	t.Run("Unregistered host manages primary links", func(t *testing.T) {
+		w := do("GET", "10.0.0.1:8080", "/info/promo", "")
+		var response GetURLResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK || response.OriginalURL != "https://www.example.com" {
+			t.Errorf("Expected the primary link, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Unregistered host serves no links with strict domains", func(t *testing.T) {
+		mockService.strictDomains = true
+		defer func() { mockService.strictDomains = false }()
+		if w := do("GET", "10.0.0.1:8080", "/promo", ""); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("Management names the domain explicitly", func(t *testing.T) {
+		w := do("GET", "url.li", "/info/promo?domain=go.brand.com", "")
+		var response GetURLResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Domain != "go.brand.com" || response.OriginalURL != "https://brand.example.com" {
+			t.Errorf("Unexpected link: %+v", response)
+		}
+	})
+}
+
+func TestLinkPreview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, newTestStatsService())
+	router := gin.New()
+	router.GET("/:shortURL", handler.RedirectToLongURL)
+	router.GET("/:shortURL/*path", handler.RedirectToLongURL)
+
+	ctx := context.Background()
+	mockService.ShortenURL(ctx, `https://www.example.com/?q="><script>alert(1)</script>`, domain.ShortenOptions{Alias: "plain"})
+	mockService.ShortenURL(ctx, "https://www.example.com/checked", domain.ShortenOptions{Alias: "checked", Preview: true})
+	mockService.ShortenURL(ctx, "https://www.example.com/secret", domain.ShortenOptions{Alias: "secret", Password: "hunter2"})
+	mockService.ShortenURL(ctx, "javascript:alert(1)", domain.ShortenOptions{Alias: "script", Preview: true})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Suffix shows the destination escaped", func(t *testing.T) {
+		w := get("/plain+")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		body := w.Body.String()
+		if strings.Contains(body, "<script>alert(1)</script>") {
+			t.Errorf("Expected the destination to be escaped, got %q", body)
+		}
+		if !strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+			t.Errorf("Expected the escaped destination on the page, got %q", body)
+		}
+		if !strings.Contains(body, `href="/plain"`) {
+			t.Errorf("Expected a continue link to the short link, got %q", body)
+		}
+		if w.Header().Get("Location") != "" {
+			t.Errorf("Expected no redirect, got %s", w.Header().Get("Location"))
+		}
+	})
+
+	t.Run("Link with preview enabled shows the page on every visit", func(t *testing.T) {
+		w := get("/checked")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "https://www.example.com/checked") {
+			t.Errorf("Expected the destination on the page, got %q", w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), `href="/checked?continue=1"`) {
+			t.Errorf("Expected a confirmed continue link to the short link, got %q", w.Body.String())
+		}
+
+		w = get("/checked?ref=mail&continue=1")
+		if w.Code != http.StatusFound {
+			t.Fatalf("Expected status code %d, got %d", http.StatusFound, w.Code)
+		}
+		if visit := mockService.lastVisit; !visit.Confirmed || visit.Query != "ref=mail" {
+			t.Errorf("Expected a confirmed visit without the continue parameter, got %+v", visit)
+		}
+	})
+
+	t.Run("Path after the suffix is carried to the continue link", func(t *testing.T) {
+		mockService.ShortenURL(ctx, "https://docs.example.com", domain.ShortenOptions{Alias: "docs", PathPassthrough: true})
+
+		w := get("/docs+/guide/intro")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `href="/docs/guide/intro"`) {
+			t.Errorf("Expected a continue link with the path, got %q", w.Body.String())
+		}
+
+		if w := get("/plain+/extra"); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d for a path the link does not forward, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("Continue link is sanitized", func(t *testing.T) {
+		w := get("/script")
+		if strings.Contains(w.Body.String(), `href="javascript:`) {
+			t.Errorf("Expected an unsafe continue link to be filtered, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("Protected link hides its destination", func(t *testing.T) {
+		w := get("/secret+")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "www.example.com/secret") {
+			t.Errorf("Expected the destination to be hidden, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("Unknown link", func(t *testing.T) {
+		if w := get("/missing+"); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestGetQRCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, nil)
+	router := gin.New()
+	router.GET("/qr/:shortURL", handler.GetQRCode)
+
+	mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "printed"})
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/qr/printed", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("Expected a PNG, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag")
+	}
+
+	if w := get("/qr/printed", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected status code %d with no body, got %d", http.StatusNotModified, w.Code)
+	} else if w.Header().Get("ETag") != etag {
+		t.Errorf("Expected the ETag on the 304, got %q", w.Header().Get("ETag"))
+	}
+
+	w = get("/qr/printed?format=svg&size=512&level=H&margin=1", etag)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("Expected an SVG, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Error("Expected different options to have a different ETag")
+	}
+
+	for _, path := range []string{"/qr/printed?size=big", "/qr/printed?level=Z", "/qr/printed?format=gif"} {
+		if w := get(path, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", path, http.StatusBadRequest, w.Code)
+		}
+	}
+	if w := get("/qr/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	t.Run("Failed render is not cacheable", func(t *testing.T) {
+		long := strings.Repeat("a", 120)
+		mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: long})
+
+		w := get("/qr/"+long+"?size=64&margin=16&level=H", "")
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+		if w.Header().Get("ETag") != "" || w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Expected no ETag and no-store, got %q and %q", w.Header().Get("ETag"), w.Header().Get("Cache-Control"))
+		}
+	})
+}
+
+func TestSocialCards(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, newTestStatsService())
+	router := gin.New()
+	router.GET("/:shortURL", handler.RedirectToLongURL)
+	router.GET("/:shortURL/*path", handler.RedirectToLongURL)
+
+	ctx := context.Background()
+	mockService.ShortenURL(ctx, "https://www.example.com/launch", domain.ShortenOptions{
+		Alias:       "launch",
+		Title:       `Spring "launch" <sale>`,
+		Description: "Everything 20% off",
+		ImageURL:    "https://cdn.example.com/card.png",
+	})
+	mockService.ShortenURL(ctx, "https://www.example.com/bare", domain.ShortenOptions{Alias: "bare"})
+	mockService.ShortenURL(ctx, "https://www.example.com/secret", domain.ShortenOptions{Alias: "secret", Title: "Secret", Password: "hunter2"})
+	spent, _ := mockService.ShortenURL(ctx, "https://www.example.com/once", domain.ShortenOptions{Alias: "once", Title: "Once", MaxClicks: 1})
+	spent.AccessCount = 1
+
+	get := func(path, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	const slack = "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"
+
+	t.Run("Unfurler gets the card", func(t *testing.T) {
+		w := get("/launch", slack)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		body := w.Body.String()
+		for _, want := range []string{
+			`<meta property="og:title" content="Spring &#34;launch&#34; &lt;sale&gt;">`,
+			`<meta property="og:description" content="Everything 20% off">`,
+			`<meta property="og:image" content="https://cdn.example.com/card.png">`,
+			`<meta name="twitter:card" content="summary_large_image">`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected %s in %q", want, body)
+			}
+		}
+		if w.Header().Get("Vary") != "User-Agent" {
+			t.Errorf("Expected Vary: User-Agent, got %q", w.Header().Get("Vary"))
+		}
+	})
+
+	tests := []struct {
+		name      string
+		path      string
+		userAgent string
+		status    int
+	}{
+		{"Browser is redirected", "/launch", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0", http.StatusFound},
+		{"Search engine is redirected", "/launch", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", http.StatusFound},
+		{"Link without metadata is redirected", "/bare", "facebookexternalhit/1.1", http.StatusFound},
+		{"Protected link asks for the password", "/secret", "Twitterbot/1.0", http.StatusUnauthorized},
+		{"Unknown link", "/missing", "Discordbot/2.0", http.StatusNotFound},
+		{"Spent one-time link", "/once", "Slackbot-LinkExpanding 1.0", http.StatusGone},
+		{"Path the link does not forward", "/launch/extra", "Slackbot-LinkExpanding 1.0", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := get(tt.path, tt.userAgent); w.Code != tt.status {
+				t.Errorf("Expected status code %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestRejectedDestinations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	handler := NewURLHandler(mockService, nil)
+	router := gin.New()
+	router.POST("/shorten", handler.ShortenURL)
+	router.PATCH("/:shortURL", handler.UpdateURL)
+
+	mockService.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{})
+
+	tests := []struct {
+		name    string
+		longURL string
+		reason  service.RejectionReason
+	}{
+		{"IP address", "http://192.168.0.1/login", service.RejectIPLiteral},
+		{"credentials", "https://bank.example.com@evil.example.net/", service.RejectCredentials},
+		{"homograph", "https://xn--pple-43d.com/", service.RejectHomograph},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			body := `{"url": "` + tt.longURL + `"}`
+			req, _ := http.NewRequest("POST", "/shorten", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				Error  string                  `json:"error"`
+				Reason service.RejectionReason `json:"reason"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Reason != tt.reason {
+				t.Errorf("Expected reason %s, got %s", tt.reason, response.Reason)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/testshort", strings.NewReader(`{"url": "http://10.0.0.1/"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 on update, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"reason":"ip_literal"`) {
+		t.Errorf("Expected ip_literal reason on update, got %s", w.Body.String())
+	}
+}
@@ -7,8 +7,23 @@ import (
 )
 
 type URLServiceInterface interface {
-	ShortenURL(ctx context.Context, longURL string) (*domain.URL, error)
-	GetLongURL(ctx context.Context, shortCode string) (string, error)
-	GetURLInfo(ctx context.Context, shortCode string) (*domain.URL, error)
-	DeleteURL(ctx context.Context, shortCode string) error
+	ShortenURL(ctx context.Context, longURL string, opts domain.ShortenOptions) (*domain.URL, error)
+	ResolveRedirect(ctx context.Context, host, shortCode string, visit domain.Visit) (*domain.Redirect, error)
+	UnlockRedirect(ctx context.Context, host, shortCode, password string, visit domain.Visit) (*domain.Redirect, error)
+	GetURLInfo(ctx context.Context, host, shortCode string) (*domain.URL, error)
+	PreviewURL(ctx context.Context, host, shortCode string, visit domain.Visit) (*domain.URL, error)
+	UpdateURL(ctx context.Context, host, shortCode string, opts domain.UpdateOptions) (*domain.URL, error)
+	DeleteURL(ctx context.Context, host, shortCode string) error
+	ListURLs(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error)
+	RestoreURL(ctx context.Context, host, shortCode string) error
+	PurgeURL(ctx context.Context, host, shortCode string) error
+
+	GetUTMTemplate(ctx context.Context, owner string) (*domain.UTMTemplate, error)
+	SaveUTMTemplate(ctx context.Context, owner string, utm domain.UTM) (*domain.UTMTemplate, error)
+	DeleteUTMTemplate(ctx context.Context, owner string) error
+
+	ResolveHost(ctx context.Context, host string) (string, error)
+	ListDomains(ctx context.Context) ([]domain.ShortDomain, error)
+	AddDomain(ctx context.Context, host string) (*domain.ShortDomain, error)
+	RemoveDomain(ctx context.Context, host string) error
 }
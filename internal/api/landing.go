@@ -0,0 +1,263 @@
+package api
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/kakuzops/ml-url/internal/domain"
+	"github.com/kakuzops/ml-url/internal/service"
+)
+
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+const (
+	// defaultTemplate renders every landing page that has no template of its own.
+	defaultTemplate  = "error.html"
+	passwordTemplate = "password.html"
+	previewTemplate  = "preview.html"
+	cardTemplate     = "card.html"
+)
+
+// LandingPage is the data passed to landing page templates.
+type LandingPage struct {
+	Status    int
+	Code      string
+	Title     string
+	Message   string
+	ShortCode string
+	// ActivatesAt is set on the page for links that are not active yet.
+	ActivatesAt string
+}
+
+// PasswordPage is the data passed to the password prompt template.
+type PasswordPage struct {
+	ShortCode string
+	Error     string
+}
+
+// PreviewPage is the data passed to the link preview template. Destination
+// is empty when the link does not disclose it, and Notice then says why.
+type PreviewPage struct {
+	ShortCode   string
+	ShortURL    string
+	Title       string
+	Destination string
+	Notice      string
+	// Location is where the continue link leads.
+	Location    string
+	CreatedAt   string
+	ExpiresAt   string
+	AccessCount int64
+}
+
+// CardPage is the data passed to the social card template served to link
+// unfurlers.
+type CardPage struct {
+	ShortURL    string
+	Title       string
+	Description string
+	ImageURL    string
+}
+
+// LinkError is the JSON body returned when a link cannot be followed.
+type LinkError struct {
+	Error       string `json:"error"`
+	Code        string `json:"code"`
+	ActivatesAt string `json:"activates_at,omitempty"`
+}
+
+// LoadTemplates parses the built-in landing pages and, when dir is set, every
+// *.html file in it. A file named after an error code (not_found.html,
+// expired.html, deleted.html, exhausted.html, not_active.html) replaces the page for that code; error.html
+// replaces the fallback, password.html the prompt for protected links,
+// preview.html the link preview page and card.html the social card.
+func LoadTemplates(dir string) (*template.Template, error) {
+	templates, err := template.ParseFS(defaultTemplates, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse built-in templates: %w", err)
+	}
+	if dir == "" {
+		return templates, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %w", file, err)
+		}
+		if _, err := templates.New(filepath.Base(file)).Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", file, err)
+		}
+	}
+	return templates, nil
+}
+
+func linkErrorPage(err error) (LandingPage, bool) {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return LandingPage{
+			Status:  http.StatusNotFound,
+			Code:    "not_found",
+			Title:   "Link not found",
+			Message: "This short link does not exist. Check that it was typed correctly.",
+		}, true
+	case errors.Is(err, domain.ErrExpired):
+		return LandingPage{
+			Status:  http.StatusGone,
+			Code:    "expired",
+			Title:   "Link expired",
+			Message: "This short link has expired and no longer redirects anywhere.",
+		}, true
+	case errors.Is(err, domain.ErrDeleted):
+		return LandingPage{
+			Status:  http.StatusGone,
+			Code:    "deleted",
+			Title:   "Link removed",
+			Message: "This short link has been removed by its owner.",
+		}, true
+	case errors.Is(err, domain.ErrExhausted):
+		return LandingPage{
+			Status:  http.StatusGone,
+			Code:    "exhausted",
+			Title:   "Link no longer available",
+			Message: "This short link has already been used as many times as it allows.",
+		}, true
+	case errors.Is(err, domain.ErrNotActive):
+		page := LandingPage{
+			Status:  http.StatusForbidden,
+			Code:    "not_active",
+			Title:   "Coming soon",
+			Message: "This short link is not active yet. Please come back later.",
+		}
+		var notActive *domain.NotActiveError
+		if errors.As(err, &notActive) {
+			page.ActivatesAt = notActive.ActivatesAt.Format(time.RFC3339)
+		}
+		return page, true
+	default:
+		return LandingPage{}, false
+	}
+}
+
+// respondLinkError answers a failed link lookup with 404 for unknown codes,
+// 410 Gone for expired, deleted or exhausted ones, 403 for links that are not
+// active yet, and 500 for anything else. Browsers asking for HTML get a
+// landing page, or are sent to the coming soon URL when one is configured;
+// everyone else gets JSON.
+func (h *URLHandler) respondLinkError(c *gin.Context, shortCode string, err error) {
+	page, ok := linkErrorPage(err)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	page.ShortCode = shortCode
+
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		if h.comingSoonURL != "" && errors.Is(err, domain.ErrNotActive) {
+			c.Header("Cache-Control", "no-store")
+			c.Redirect(http.StatusFound, h.comingSoonURL)
+			return
+		}
+		name := page.Code + ".html"
+		if h.templates.Lookup(name) == nil {
+			name = defaultTemplate
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Render(page.Status, render.HTML{Template: h.templates, Name: name, Data: page})
+		return
+	}
+
+	c.JSON(page.Status, LinkError{Error: err.Error(), Code: page.Code, ActivatesAt: page.ActivatesAt})
+}
+
+// respondPasswordPrompt asks for the password of a protected link, showing
+// why the previous attempt failed if there was one.
+func (h *URLHandler) respondPasswordPrompt(c *gin.Context, shortCode string, err error) {
+	status, code, message := http.StatusUnauthorized, "password_required", ""
+	switch {
+	case errors.Is(err, service.ErrWrongPassword):
+		code, message = "wrong_password", "Incorrect password."
+	case errors.Is(err, service.ErrTooManyAttempts):
+		status, code, message = http.StatusTooManyRequests, "too_many_attempts", "Too many incorrect passwords. Please try again later."
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		c.Render(status, render.HTML{Template: h.templates, Name: passwordTemplate, Data: PasswordPage{
+			ShortCode: shortCode,
+			Error:     message,
+		}})
+		return
+	}
+
+	c.JSON(status, LinkError{Error: err.Error(), Code: code})
+}
+
+func newPreviewPage(shortCode string, url *domain.URL, location string) PreviewPage {
+	page := PreviewPage{
+		ShortCode:   shortCode,
+		ShortURL:    url.ShortURL,
+		Title:       url.Title,
+		Destination: url.LongURL,
+		Location:    location,
+		CreatedAt:   url.CreatedAt.Format(time.RFC3339),
+		AccessCount: url.AccessCount,
+	}
+	if url.ExpiresAt != nil {
+		page.ExpiresAt = url.ExpiresAt.Format(time.RFC3339)
+	}
+	return page
+}
+
+// respondPreview shows what a link leads to. Every value is escaped by
+// html/template, and the continue link is sanitized as a URL.
+func (h *URLHandler) respondPreview(c *gin.Context, page PreviewPage) {
+	c.Header("Cache-Control", "no-store")
+	c.Render(http.StatusOK, render.HTML{Template: h.templates, Name: previewTemplate, Data: page})
+}
+
+// respondCard answers a link unfurler with the link's Open Graph and
+// Twitter card metadata and reports whether it did. Links without any
+// metadata, protected links and visits that would fail, such as to a
+// link with no clicks left or with a path it does not forward, are left to
+// the redirect, so the unfurler sees what a visitor would. Nothing is
+// counted, so a card never uses up a click-limited link.
+func (h *URLHandler) respondCard(c *gin.Context, host, shortCode string) bool {
+	url, err := h.urlService.PreviewURL(c.Request.Context(), host, shortCode, newVisit(c))
+	if err != nil || url.IsProtected() {
+		return false
+	}
+	if url.Title == "" && url.Description == "" && url.ImageURL == "" {
+		return false
+	}
+
+	page := CardPage{
+		ShortURL:    url.ShortURL,
+		Title:       url.Title,
+		Description: url.Description,
+		ImageURL:    url.ImageURL,
+	}
+	if page.Title == "" {
+		page.Title = url.ShortURL
+	}
+
+	// The same URL redirects browsers, so shared caches must not hand this
+	// page to them.
+	c.Header("Vary", "User-Agent")
+	c.Header("Cache-Control", "no-store")
+	c.Render(http.StatusOK, render.HTML{Template: h.templates, Name: cardTemplate, Data: page})
+	return true
+}
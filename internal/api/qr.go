@@ -0,0 +1,118 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kakuzops/ml-url/internal/service"
+)
+
+// qrMaxAge is how long clients may cache a QR code. The short URL it encodes
+// never changes, and the ETag lets them revalidate cheaply afterwards.
+const qrMaxAge = 24 * 60 * 60
+
+var qrContentTypes = map[string]string{
+	service.QRFormatPNG: "image/png",
+	service.QRFormatSVG: "image/svg+xml",
+}
+
+// GetQRCode renders the full short URL of a link as a QR code. Query
+// parameters select the format (png or svg), size in pixels, error
+// correction level (L, M, Q or H) and margin in modules.
+func (h *URLHandler) GetQRCode(c *gin.Context) {
+	host, shortCode := h.managedLink(c, "shortURL")
+
+	size, err := intQuery(c, "size")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	margin, err := intQuery(c, "margin")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := service.QROptions{
+		Format: c.Query("format"),
+		Level:  c.Query("level"),
+		Margin: margin,
+	}
+	if size != nil {
+		opts.Size = *size
+	}
+	opts, err = opts.Normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	url, err := h.urlService.GetURLInfo(c.Request.Context(), host, shortCode)
+	if err != nil {
+		h.respondLinkError(c, shortCode, err)
+		return
+	}
+
+	// The image depends only on what it encodes and how it is drawn, so
+	// the ETag can be checked before rendering anything.
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%s|%d", url.ShortURL, opts.Format, opts.Size, opts.Level, *opts.Margin)))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	if matchesETag(c.GetHeader("If-None-Match"), etag) {
+		setQRCacheHeaders(c, etag)
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	qr, err := service.RenderQR(url.ShortURL, opts)
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		if errors.Is(err, service.ErrInvalidQR) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setQRCacheHeaders(c, etag)
+	c.Data(http.StatusOK, qrContentTypes[opts.Format], qr)
+}
+
+// setQRCacheHeaders lets clients cache a QR code that was, or could be,
+// rendered. Errors must not get them, or the ETag would stand for an error.
+func setQRCacheHeaders(c *gin.Context, etag string) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", qrMaxAge))
+}
+
+// intQuery parses an optional integer query parameter.
+func intQuery(c *gin.Context, name string) (*int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", name)
+	}
+	return &n, nil
+}
+
+// matchesETag reports whether an If-None-Match header lists etag, ignoring
+// weak validator prefixes.
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kakuzops/ml-url/internal/domain"
+	"github.com/kakuzops/ml-url/internal/service"
+)
+
+// UTM lists the campaign parameters added to a link's destination. Values
+// may use {code} and {title}, replaced by the link's short code and title.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+type UTMTemplateResponse struct {
+	Owner     string `json:"owner"`
+	UTM       UTM    `json:"utm"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+func (u UTM) toDomain() domain.UTM {
+	return domain.UTM{
+		Source:   u.Source,
+		Medium:   u.Medium,
+		Campaign: u.Campaign,
+		Term:     u.Term,
+		Content:  u.Content,
+	}
+}
+
+func newUTM(utm domain.UTM) *UTM {
+	if utm.IsZero() {
+		return nil
+	}
+	return &UTM{
+		Source:   utm.Source,
+		Medium:   utm.Medium,
+		Campaign: utm.Campaign,
+		Term:     utm.Term,
+		Content:  utm.Content,
+	}
+}
+
+func newUTMTemplateResponse(template *domain.UTMTemplate) UTMTemplateResponse {
+	response := UTMTemplateResponse{
+		Owner:     template.Owner,
+		UpdatedAt: template.UpdatedAt.Format(time.RFC3339),
+	}
+	if utm := newUTM(template.UTM); utm != nil {
+		response.UTM = *utm
+	}
+	return response
+}
+
+// GetUTMTemplate returns the default UTM parameters of the X-Owner-ID account.
+func (h *URLHandler) GetUTMTemplate(c *gin.Context) {
+	owner := c.GetHeader(OwnerHeader)
+	if owner == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": OwnerHeader + " header is required"})
+		return
+	}
+
+	template, err := h.urlService.GetUTMTemplate(c.Request.Context(), owner)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "UTM template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newUTMTemplateResponse(template))
+}
+
+// SetUTMTemplate replaces the default UTM parameters of the X-Owner-ID
+// account. They apply to links created afterwards.
+func (h *URLHandler) SetUTMTemplate(c *gin.Context) {
+	owner := c.GetHeader(OwnerHeader)
+	if owner == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": OwnerHeader + " header is required"})
+		return
+	}
+
+	var req UTM
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	template, err := h.urlService.SaveUTMTemplate(c.Request.Context(), owner, req.toDomain())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUTM) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newUTMTemplateResponse(template))
+}
+
+func (h *URLHandler) DeleteUTMTemplate(c *gin.Context) {
+	owner := c.GetHeader(OwnerHeader)
+	if owner == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": OwnerHeader + " header is required"})
+		return
+	}
+
+	if err := h.urlService.DeleteUTMTemplate(c.Request.Context(), owner); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "UTM template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "UTM template deleted successfully"})
+}
@@ -2,19 +2,53 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Postgres PostgresConfig
-	Redis    RedisConfig
-	BaseURL  string
-	Duration time.Duration
+	Server    ServerConfig
+	Postgres  PostgresConfig
+	Redis     RedisConfig
+	ShortCode ShortCodeConfig
+	KeyPool   KeyPoolConfig
+	Dedupe    DedupeConfig
+	Safety    SafetyConfig
+	BaseURL   string
+	Duration  time.Duration
+	// MinDuration and MaxDuration bound the lifetime a client may request
+	// per link; a zero MaxDuration means no upper bound.
+	MinDuration    time.Duration
+	MaxDuration    time.Duration
+	AllowPermanent bool
+	// DefaultRedirect is the status used for links without their own redirect_type;
+	// RedirectCacheMaxAge bounds how long 301/308 redirects may be cached.
+	DefaultRedirect     int
+	RedirectCacheMaxAge time.Duration
+	// AccessFlushInterval is how often buffered visit counts are written to Postgres.
+	AccessFlushInterval time.Duration
+	// PasswordMaxAttempts wrong passwords lock a protected link for PasswordLockout.
+	PasswordMaxAttempts int
+	PasswordLockout     time.Duration
+	// TemplatesDir holds HTML files that override the built-in landing pages.
+	TemplatesDir string
+	// GeoIPDatabase is the path of a MaxMind-format (.mmdb) country database
+	// used by targeting rules with countries; empty disables them.
+	GeoIPDatabase string
+	// ComingSoonURL, when set, is where browsers visiting a link before its
+	// activates_at are sent instead of the built-in coming soon page.
+	ComingSoonURL string
+	// StrictDomains makes hosts that are neither BaseURL's nor registered
+	// serve no links, instead of the primary domain's.
+	StrictDomains bool
 }
 
 type ServerConfig struct {
 	Port string
+	// TrustedProxies lists the proxy IPs or CIDRs whose X-Forwarded-For
+	// header is believed when working out the client IP; empty trusts none.
+	TrustedProxies []string
 }
 
 type PostgresConfig struct {
@@ -25,6 +59,50 @@ type PostgresConfig struct {
 	DBName   string
 }
 
+// ShortCodeConfig selects how new short codes are generated: "random",
+// "sequence" or "obfuscated".
+type ShortCodeConfig struct {
+	Generator string
+	Length    int
+	Secret    string
+}
+
+// KeyPoolConfig controls the pre-allocated short code pool. When enabled,
+// codes from the configured generator are stored ahead of time and leased
+// into each server process in batches.
+type KeyPoolConfig struct {
+	Enabled        bool
+	LeaseSize      int
+	LowWatermark   int
+	LeaseTTL       time.Duration
+	RefillInterval time.Duration
+	MinAvailable   int
+	GenerateBatch  int
+}
+
+// DedupeConfig sets whether POST /shorten reuses an existing link for the
+// same long URL when the request does not say otherwise.
+type DedupeConfig struct {
+	Enabled  bool
+	PerOwner bool
+}
+
+// SafetyConfig selects the checks destinations of new and updated links
+// must pass. The list files are reloaded every ReloadInterval when they
+// change; empty paths disable them. Links of ShortenerHosts are rejected, or
+// followed to their final destination within ResolveTimeout when
+// ResolveShorteners is set.
+type SafetyConfig struct {
+	DomainList     string
+	HashList       string
+	Heuristics     bool
+	ReloadInterval time.Duration
+
+	ShortenerHosts    []string
+	ResolveShorteners bool
+	ResolveTimeout    time.Duration
+}
+
 type RedisConfig struct {
 	Host     string
 	Port     string
@@ -35,7 +113,8 @@ type RedisConfig struct {
 func LoadConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			TrustedProxies: getListEnv("TRUSTED_PROXIES"),
 		},
 		Postgres: PostgresConfig{
 			Host:     getEnv("POSTGRES_HOST", "localhost"),
@@ -50,8 +129,49 @@ func LoadConfig() *Config {
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       0,
 		},
-		BaseURL:  getEnv("BASE_URL", "http://url.li"),
-		Duration: getDurationEnv("URL_DURATION", 24*time.Hour),
+		ShortCode: ShortCodeConfig{
+			Generator: getEnv("SHORT_CODE_GENERATOR", "random"),
+			Length:    getIntEnv("SHORT_CODE_LENGTH", 8),
+			Secret:    getEnv("SHORT_CODE_SECRET", ""),
+		},
+		KeyPool: KeyPoolConfig{
+			Enabled:        getBoolEnv("KEY_POOL_ENABLED", false),
+			LeaseSize:      getIntEnv("KEY_POOL_LEASE_SIZE", 1000),
+			LowWatermark:   getIntEnv("KEY_POOL_LOW_WATERMARK", 200),
+			LeaseTTL:       getDurationEnv("KEY_POOL_LEASE_TTL", 10*time.Minute),
+			RefillInterval: getDurationEnv("KEY_POOL_REFILL_INTERVAL", 30*time.Second),
+			MinAvailable:   getIntEnv("KEY_POOL_MIN_AVAILABLE", 100000),
+			GenerateBatch:  getIntEnv("KEY_POOL_GENERATE_BATCH", 10000),
+		},
+		Dedupe: DedupeConfig{
+			Enabled:  getBoolEnv("DEDUPE_URLS", false),
+			PerOwner: getBoolEnv("DEDUPE_PER_OWNER", true),
+		},
+		Safety: SafetyConfig{
+			DomainList:     getEnv("URL_DOMAIN_LIST", ""),
+			HashList:       getEnv("URL_HASH_LIST", ""),
+			Heuristics:     getBoolEnv("URL_HEURISTICS", true),
+			ReloadInterval: getDurationEnv("URL_LIST_RELOAD_INTERVAL", 30*time.Second),
+
+			ShortenerHosts:    getListEnv("URL_SHORTENER_HOSTS"),
+			ResolveShorteners: getBoolEnv("URL_RESOLVE_SHORTENERS", false),
+			ResolveTimeout:    getDurationEnv("URL_RESOLVE_TIMEOUT", 5*time.Second),
+		},
+		BaseURL:        getEnv("BASE_URL", "http://url.li"),
+		Duration:       getDurationEnv("URL_DURATION", 24*time.Hour),
+		MinDuration:    getDurationEnv("URL_MIN_DURATION", time.Minute),
+		MaxDuration:    getDurationEnv("URL_MAX_DURATION", 365*24*time.Hour),
+		AllowPermanent: getBoolEnv("ALLOW_PERMANENT_URLS", true),
+
+		DefaultRedirect:     getIntEnv("DEFAULT_REDIRECT_TYPE", 302),
+		RedirectCacheMaxAge: getDurationEnv("REDIRECT_CACHE_MAX_AGE", time.Hour),
+		AccessFlushInterval: getDurationEnv("ACCESS_FLUSH_INTERVAL", 10*time.Second),
+		PasswordMaxAttempts: getIntEnv("PASSWORD_MAX_ATTEMPTS", 5),
+		PasswordLockout:     getDurationEnv("PASSWORD_LOCKOUT", 15*time.Minute),
+		TemplatesDir:        getEnv("TEMPLATES_DIR", ""),
+		ComingSoonURL:       getEnv("COMING_SOON_URL", ""),
+		GeoIPDatabase:       getEnv("GEOIP_DATABASE", ""),
+		StrictDomains:       getBoolEnv("STRICT_DOMAINS", false),
 	}
 }
 
@@ -62,6 +182,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getListEnv splits a comma-separated variable, dropping empty entries.
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -70,3 +201,21 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
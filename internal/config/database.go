@@ -36,7 +36,8 @@ func NewDatabase() (*gorm.DB, error) {
 	log.Printf("Connecting to PostgreSQL at %s:%s", cfg.Postgres.Host, cfg.Postgres.Port)
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: newLogger,
+		Logger:         newLogger,
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
@@ -18,12 +18,28 @@ func RunMigrations(db *gorm.DB) error {
 		log.Println("Table 'shorten_url' will be created")
 	}
 
-	err := db.AutoMigrate(&domain.URL{})
+	err := db.AutoMigrate(&domain.URL{}, &domain.ShortCodeKey{}, &domain.AuditEntry{}, &domain.TargetingRule{}, &domain.Variant{}, &domain.UTMTemplate{}, &domain.ShortDomain{})
 	if err != nil {
 		log.Printf("Error during migration: %v", err)
 		return err
 	}
 
+	// Codes used to be unique on their own; they are now unique per domain.
+	for _, statement := range []string{
+		"ALTER TABLE shorten_url DROP CONSTRAINT IF EXISTS shorten_url_short_url_key",
+		"DROP INDEX IF EXISTS idx_shorten_url_short_url",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			log.Printf("Error dropping global short_url uniqueness: %v", err)
+			return err
+		}
+	}
+
+	if err := db.Exec("CREATE SEQUENCE IF NOT EXISTS short_code_seq").Error; err != nil {
+		log.Printf("Error creating short code sequence: %v", err)
+		return err
+	}
+
 	var columns []string
 	db.Raw("SELECT column_name FROM information_schema.columns WHERE table_name = 'shorten_url'").Pluck("column_name", &columns)
 	log.Printf("Table columns: %v", columns)
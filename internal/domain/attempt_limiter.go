@@ -0,0 +1,18 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// AttemptLimiter tracks attempts per key and locks the key out once too many
+// fail within a window.
+type AttemptLimiter interface {
+	// Attempt counts an attempt before it is made, so concurrent attempts
+	// cannot slip past the limit together. It returns how long key stays
+	// locked out when the attempt is over the limit, or zero if it may go
+	// ahead.
+	Attempt(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets the attempts at key after one succeeds.
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// AuditEntry records a change made to a link and who made it.
+type AuditEntry struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	URLID     string    `json:"url_id" gorm:"type:varchar(36);not null;index"`
+	ShortURL  string    `json:"short_url" gorm:"type:varchar(255);not null"`
+	Actor     string    `json:"actor" gorm:"type:varchar(255);not null"`
+	Action    string    `json:"action" gorm:"type:varchar(32);not null"`
+	Changes   string    `json:"changes" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (AuditEntry) TableName() string {
+	return "url_audit_log"
+}
+
+// FieldChange is the before and after value of a single field in an AuditEntry.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
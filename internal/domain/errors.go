@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("URL not found")
+	ErrExpired       = errors.New("URL has expired")
+	ErrDeleted       = errors.New("URL has been deleted")
+	ErrExhausted     = errors.New("URL has reached its click limit")
+	ErrNotActive     = errors.New("URL is not active yet")
+	ErrShortURLTaken = errors.New("short URL already in use")
+	ErrDomainTaken   = errors.New("domain already registered")
+)
+
+// NotActiveError is returned for a link visited before its activates_at.
+// It matches ErrNotActive with errors.Is.
+type NotActiveError struct {
+	ActivatesAt time.Time
+}
+
+func (e *NotActiveError) Error() string {
+	return fmt.Sprintf("URL is not active until %s", e.ActivatesAt.Format(time.RFC3339))
+}
+
+func (e *NotActiveError) Unwrap() error {
+	return ErrNotActive
+}
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ShortCodeKey is a pre-generated, unused short code waiting in the key pool.
+// A key is available while LeasedBy is nil and leased to a server process otherwise.
+type ShortCodeKey struct {
+	Code           string     `gorm:"primaryKey;type:varchar(32)"`
+	LeasedBy       *string    `gorm:"type:varchar(255);index"`
+	LeaseExpiresAt *time.Time `gorm:"index"`
+	CreatedAt      time.Time  `gorm:"not null"`
+}
+
+func (ShortCodeKey) TableName() string {
+	return "short_code_pool"
+}
+
+type KeyPoolRepository interface {
+	Insert(ctx context.Context, codes []string) (int64, error)
+	Lease(ctx context.Context, owner string, count int, ttl time.Duration) ([]string, error)
+	Renew(ctx context.Context, owner string, ttl time.Duration) error
+	Consume(ctx context.Context, codes []string) error
+	Release(ctx context.Context, owner string) error
+	ReclaimExpired(ctx context.Context) (int64, error)
+	CountAvailable(ctx context.Context) (int64, error)
+}
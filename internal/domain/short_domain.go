@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ShortDomain is a branded host links can be created on besides the
+// primary one in BASE_URL. Each domain has its own namespace of codes.
+type ShortDomain struct {
+	Host      string    `json:"host" gorm:"primaryKey;type:varchar(255)"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (ShortDomain) TableName() string {
+	return "short_domains"
+}
+
+type DomainRepository interface {
+	List(ctx context.Context) ([]ShortDomain, error)
+	// Add registers a domain, returning ErrDomainTaken if it already exists.
+	Add(ctx context.Context, domain *ShortDomain) error
+	// Remove forgets a domain, returning ErrNotFound if it is not registered.
+	Remove(ctx context.Context, host string) error
+}
+
+// LinkKey identifies a link across domains in caches and counters. Links on
+// the primary domain, whose Domain is empty, keep their bare code so keys
+// written before domains existed stay valid.
+func LinkKey(host, code string) string {
+	if host == "" {
+		return code
+	}
+	return host + "/" + code
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+// TargetingRule sends matching visitors to Destination instead of the link's
+// LongURL. Every condition that is set must match; an empty condition
+// matches any visitor. Rules are evaluated in Position order and the first
+// match wins.
+type TargetingRule struct {
+	ID       uint   `json:"-" gorm:"primaryKey"`
+	URLID    string `json:"-" gorm:"type:varchar(36);not null;index"`
+	Position int    `json:"-" gorm:"not null"`
+
+	// OS is one of ios, android, windows, macos or linux.
+	OS string `json:"os,omitempty" gorm:"type:varchar(16)"`
+	// Device is one of mobile, tablet, desktop or bot.
+	Device string `json:"device,omitempty" gorm:"type:varchar(16)"`
+	// Languages is a comma-separated list of language tags such as "pt,es-AR";
+	// a bare language also matches its regional variants.
+	Languages string `json:"languages,omitempty" gorm:"type:varchar(255)"`
+	// Countries is a comma-separated list of ISO 3166-1 alpha-2 codes
+	// matched against the visitor's IP address.
+	Countries string `json:"countries,omitempty" gorm:"type:varchar(255)"`
+	// TimeFrom and TimeTo bound the time of day ("15:04") in Timezone, UTC
+	// when empty. A window whose end is before its start wraps past midnight.
+	TimeFrom string `json:"time_from,omitempty" gorm:"type:varchar(5)"`
+	TimeTo   string `json:"time_to,omitempty" gorm:"type:varchar(5)"`
+	Timezone string `json:"timezone,omitempty" gorm:"type:varchar(64)"`
+
+	Destination string `json:"destination" gorm:"type:text;not null"`
+}
+
+func (TargetingRule) TableName() string {
+	return "url_targeting_rules"
+}
+
+// Visit describes the request following a short link, as far as targeting
+// rules are concerned.
+type Visit struct {
+	UserAgent      string
+	AcceptLanguage string
+	ClientIP       string
+	Time           time.Time
+	// Variant is the A/B variant the visitor was given on an earlier visit.
+	Variant string
+	// Path is what followed the short code in the request path, without the
+	// leading slash, and Query the raw query string.
+	Path  string
+	Query string
+	// Confirmed is set when the visitor continued from the link's preview
+	// page, so the visit is followed instead of previewed again.
+	Confirmed bool
+}
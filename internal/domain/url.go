@@ -9,18 +9,94 @@ import (
 )
 
 type URL struct {
-	ID        string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
-	LongURL   string         `json:"long_url" gorm:"type:text;not null"`
-	ShortURL  string         `json:"short_url" gorm:"type:varchar(255);uniqueIndex;not null"`
-	CreatedAt time.Time      `json:"created_at" gorm:"not null"`
-	ExpiresAt time.Time      `json:"expires_at" gorm:"not null;index"`
+	ID          string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	LongURL     string     `json:"long_url" gorm:"type:text;not null"`
+	LongURLHash string     `json:"long_url_hash,omitempty" gorm:"type:varchar(64);index:idx_shorten_url_long_url_hash_owner"`
+	Owner       string     `json:"owner,omitempty" gorm:"type:varchar(255);index:idx_shorten_url_long_url_hash_owner"`
+	ShortURL    string     `json:"short_url" gorm:"type:varchar(255);uniqueIndex:idx_shorten_url_domain_short_url,priority:2;not null"`
+	Title       string     `json:"title,omitempty" gorm:"type:varchar(255)"`
+	Description string     `json:"description,omitempty" gorm:"type:text"`
+	ImageURL    string     `json:"image_url,omitempty" gorm:"type:text"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"not null"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" gorm:"index"`
+	// Domain is the branded host the link lives on; empty means the primary
+	// domain. Codes are unique per domain.
+	Domain string `json:"domain,omitempty" gorm:"type:varchar(255);not null;default:'';uniqueIndex:idx_shorten_url_domain_short_url,priority:1"`
+	// ActivatesAt is when the link starts redirecting; nil means immediately.
+	ActivatesAt *time.Time `json:"activates_at,omitempty"`
+	// RedirectType is the HTTP status used to redirect; zero means the server default.
+	RedirectType int `json:"redirect_type,omitempty" gorm:"not null;default:0"`
+	// PasswordHash is the bcrypt hash visitors must match before being
+	// redirected; empty means the link is public.
+	PasswordHash string `json:"password_hash,omitempty" gorm:"type:varchar(255)"`
+	// MaxClicks is how many redirects the link serves before it is
+	// exhausted; zero means unlimited.
+	MaxClicks int64 `json:"max_clicks,omitempty" gorm:"not null;default:0"`
+	// Rules pick a different destination for some visitors before falling
+	// back to LongURL.
+	Rules []TargetingRule `json:"rules,omitempty" gorm:"foreignKey:URLID;constraint:OnDelete:CASCADE"`
+	// QueryMerge decides whether and how the visitor's query string is added
+	// to the destination; empty drops it.
+	QueryMerge string `json:"query_merge,omitempty" gorm:"type:varchar(16)"`
+	// PathPassthrough appends whatever follows the code in the request path
+	// to the destination, so one link can front a whole tree of pages.
+	PathPassthrough bool `json:"path_passthrough,omitempty" gorm:"not null;default:false"`
+	// UTM is added to the destination's query string on every redirect.
+	UTM UTM `json:"utm" gorm:"embedded;embeddedPrefix:utm_"`
+	// Preview shows visitors a page with the destination instead of
+	// redirecting them to it.
+	Preview bool `json:"preview,omitempty" gorm:"not null;default:false"`
+	// Variants split the visitors no rule matched across weighted
+	// destinations instead of LongURL.
+	Variants []Variant `json:"variants,omitempty" gorm:"foreignKey:URLID;constraint:OnDelete:CASCADE"`
+
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	AccessCount    int64      `json:"access_count" gorm:"not null;default:0"`
+
 	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+
+	// Existing is set when ShortenURL returned a previously created link
+	// instead of creating a new one.
+	Existing bool `json:"-" gorm:"-"`
 }
 
+// Query merge policies decide what happens to a visitor's query parameters
+// that the destination also sets.
+const (
+	QueryMergeNone     = ""
+	QueryMergeKeep     = "keep"     // the destination's value wins
+	QueryMergeOverride = "override" // the visitor's value wins
+	QueryMergeAppend   = "append"   // both values are kept
+)
+
 func (URL) TableName() string {
 	return "shorten_url"
 }
 
+// NeverExpires reports whether the link is permanent.
+func (u *URL) NeverExpires() bool {
+	return u.ExpiresAt == nil
+}
+
+func (u *URL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// IsActive reports whether the link's activation time has been reached.
+func (u *URL) IsActive(now time.Time) bool {
+	return u.ActivatesAt == nil || !now.Before(*u.ActivatesAt)
+}
+
+// HasClickLimit reports whether the link stops redirecting after MaxClicks visits.
+func (u *URL) HasClickLimit() bool {
+	return u.MaxClicks > 0
+}
+
+// IsProtected reports whether visitors need a password to follow the link.
+func (u *URL) IsProtected() bool {
+	return u.PasswordHash != ""
+}
+
 func (u *URL) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == "" {
 		u.ID = uuid.New().String()
@@ -28,8 +104,141 @@ func (u *URL) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+type ShortenOptions struct {
+	// Domain is the registered host to create the link on; empty means the
+	// primary domain.
+	Domain      string
+	Alias       string
+	Owner       string
+	Title       string
+	Description string
+	ImageURL    string
+	// Dedupe overrides the service-wide deduplication setting when set.
+	Dedupe *bool
+
+	// At most one of ExpiresAt, TTL and NeverExpires may be set; when none
+	// is, the service default duration applies. TTL and the default count
+	// from ActivatesAt when it is in the future.
+	ExpiresAt    *time.Time
+	TTL          time.Duration
+	NeverExpires bool
+	ActivatesAt  *time.Time
+
+	RedirectType int
+	// Password protects the link when non-empty.
+	Password string
+	// MaxClicks limits how many redirects the link serves; zero means unlimited.
+	MaxClicks int64
+	Rules     []TargetingRule
+	Variants  []Variant
+
+	QueryMerge      string
+	PathPassthrough bool
+	// UTM parameters left empty are taken from the owner's UTM template.
+	UTM UTM
+
+	Preview bool
+}
+
+func (o ShortenOptions) HasExpiration() bool {
+	return o.ExpiresAt != nil || o.TTL != 0 || o.NeverExpires
+}
+
+// UpdateOptions lists the fields to change on an existing link; nil fields
+// and an absent expiration are left untouched.
+type UpdateOptions struct {
+	Actor       string
+	LongURL     *string
+	Title       *string
+	Description *string
+	ImageURL    *string
+
+	RedirectType *int
+	// Password sets a new password; an empty string removes protection.
+	Password *string
+	// MaxClicks sets a new click limit; zero removes it.
+	MaxClicks *int64
+	// Rules replaces the targeting rules; an empty slice removes them.
+	Rules *[]TargetingRule
+	// Variants replaces the A/B variants; an empty slice removes them.
+	Variants *[]Variant
+
+	QueryMerge      *string
+	PathPassthrough *bool
+	// UTM replaces the link's UTM parameters; a zero value removes them.
+	UTM *UTM
+
+	Preview *bool
+
+	ExpiresAt    *time.Time
+	TTL          time.Duration
+	NeverExpires bool
+	ActivatesAt  *time.Time
+	// ActivateNow removes the activation time, so the link redirects
+	// immediately; it cannot be combined with ActivatesAt.
+	ActivateNow bool
+}
+
+func (o UpdateOptions) HasExpiration() bool {
+	return o.ExpiresAt != nil || o.TTL != 0 || o.NeverExpires
+}
+
+// AccessBatch accumulates visits to one short code between two flushes.
+type AccessBatch struct {
+	Domain         string
+	ShortURL       string
+	Count          int64
+	LastAccessedAt time.Time
+}
+
+// Redirect is how a visit to a short link should be answered.
+type Redirect struct {
+	URL        *URL
+	Location   string
+	StatusCode int
+	// CacheMaxAge is how long clients may cache the redirect; zero means not at all.
+	CacheMaxAge time.Duration
+	// Destination is where the link sent this visit before its UTM
+	// parameters and the visitor's path and query were added; Location
+	// includes them.
+	Destination string
+	// Variant names the A/B variant the visitor was sent to, if any.
+	Variant string
+	// Preview is set when the visitor must see the link's preview page
+	// before following it. Nothing has been counted for the visit, and
+	// Location is where continuing leads.
+	Preview bool
+}
+
+// ListFilter selects links for listing. A nil Owner matches every owner and
+// Deleted switches from active links to soft-deleted ones.
+type ListFilter struct {
+	Owner   *string
+	Deleted bool
+	Limit   int
+	Offset  int
+}
+
+// URLRepository stores links. Links are addressed by their domain, empty for
+// the primary one, and their code within it.
 type URLRepository interface {
-	Save(ctx context.Context, url *URL) error
-	FindByShortURL(ctx context.Context, shortURL string) (*URL, error)
-	Delete(ctx context.Context, shortURL string) error
+	Create(ctx context.Context, url *URL) error
+	// Update persists changes to an existing link, replacing its targeting
+	// rules and variants, together with its audit entry.
+	Update(ctx context.Context, url *URL, audit *AuditEntry) error
+	FindByShortURL(ctx context.Context, host, shortURL string) (*URL, error)
+	// FindByLongURLHash returns the newest live link for the hash that has no
+	// password, click limit, redirect type, title, description, image,
+	// targeting rules, variants, passthrough or UTM parameters; a nil owner
+	// matches links from any owner.
+	FindByLongURLHash(ctx context.Context, host, hash string, owner *string) (*URL, error)
+	List(ctx context.Context, filter ListFilter) ([]*URL, error)
+	Delete(ctx context.Context, host, shortURL string) error
+	Restore(ctx context.Context, host, shortURL string) error
+	// Purge permanently removes a link, active or soft-deleted, freeing its code.
+	Purge(ctx context.Context, host, shortURL string) error
+	RecordAccesses(ctx context.Context, batches []AccessBatch) error
+	// FindAccess reads a link's recorded visits and when it was last
+	// visited, bypassing the cache, which does not follow them.
+	FindAccess(ctx context.Context, host, shortURL string) (int64, *time.Time, error)
 }
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// UTM holds the campaign parameters added to a link's destination when it is
+// followed. Values may use the {code} and {title} placeholders, which are
+// filled in with the link's short code and title.
+type UTM struct {
+	Source   string `json:"source,omitempty" gorm:"type:varchar(255)"`
+	Medium   string `json:"medium,omitempty" gorm:"type:varchar(255)"`
+	Campaign string `json:"campaign,omitempty" gorm:"type:varchar(255)"`
+	Term     string `json:"term,omitempty" gorm:"type:varchar(255)"`
+	Content  string `json:"content,omitempty" gorm:"type:varchar(255)"`
+}
+
+func (u UTM) IsZero() bool {
+	return u == UTM{}
+}
+
+// WithDefaults returns u with its empty fields taken from defaults.
+func (u UTM) WithDefaults(defaults UTM) UTM {
+	if u.Source == "" {
+		u.Source = defaults.Source
+	}
+	if u.Medium == "" {
+		u.Medium = defaults.Medium
+	}
+	if u.Campaign == "" {
+		u.Campaign = defaults.Campaign
+	}
+	if u.Term == "" {
+		u.Term = defaults.Term
+	}
+	if u.Content == "" {
+		u.Content = defaults.Content
+	}
+	return u
+}
+
+// UTMTemplate is an account's default UTM parameters, applied to the links it
+// creates without their own.
+type UTMTemplate struct {
+	Owner     string    `gorm:"primaryKey;type:varchar(255)"`
+	UTM       UTM       `gorm:"embedded;embeddedPrefix:utm_"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+func (UTMTemplate) TableName() string {
+	return "utm_templates"
+}
+
+type UTMTemplateRepository interface {
+	// Find returns the owner's template or ErrNotFound.
+	Find(ctx context.Context, owner string) (*UTMTemplate, error)
+	Save(ctx context.Context, template *UTMTemplate) error
+	Delete(ctx context.Context, owner string) error
+}
@@ -0,0 +1,21 @@
+package domain
+
+// Variant is one destination of an A/B split. Visitors that no targeting
+// rule matches are spread across a link's variants in proportion to Weight
+// instead of going to its LongURL, and keep the variant they were given.
+type Variant struct {
+	ID       uint   `json:"-" gorm:"primaryKey"`
+	URLID    string `json:"-" gorm:"type:varchar(36);not null;index"`
+	Position int    `json:"-" gorm:"not null"`
+
+	// Name identifies the variant in stats and in the visitor's cookie.
+	Name        string `json:"name" gorm:"type:varchar(32);not null"`
+	Destination string `json:"destination" gorm:"type:text;not null"`
+	// Weight is the variant's share of traffic relative to the others; zero
+	// pauses it.
+	Weight int `json:"weight" gorm:"not null"`
+}
+
+func (Variant) TableName() string {
+	return "url_variants"
+}
@@ -47,6 +47,34 @@ var (
 		},
 	)
 
+	shortCodeCollisionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "short_code_collisions_total",
+			Help: "Total number of generated short codes that collided with an existing one",
+		},
+	)
+
+	shortCodeExhaustedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "short_code_exhausted_total",
+			Help: "Total number of shortenings that failed after exhausting all short code attempts",
+		},
+	)
+
+	keyPoolLocalDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "key_pool_local_depth",
+			Help: "Number of leased short code keys held in memory by this process",
+		},
+	)
+
+	keyPoolAvailable = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "key_pool_available_keys",
+			Help: "Number of unleased short code keys left in the shared pool",
+		},
+	)
+
 	UrlAccessCount = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "url_access_count",
@@ -85,7 +113,7 @@ func MetricsMiddleware() gin.HandlerFunc {
 				activeURLs.Inc()
 			}
 		case c.FullPath() == "/:shortURL" && c.Request.Method == "GET":
-			if c.Writer.Status() == 301 {
+			if c.Writer.Status() >= 300 && c.Writer.Status() < 400 {
 				urlRedirectsTotal.Inc()
 			}
 		}
@@ -99,3 +127,19 @@ func IncrementActiveURLs() {
 func DecrementActiveURLs() {
 	activeURLs.Dec()
 }
+
+func IncrementShortCodeCollisions() {
+	shortCodeCollisionsTotal.Inc()
+}
+
+func IncrementShortCodeExhausted() {
+	shortCodeExhaustedTotal.Inc()
+}
+
+func SetKeyPoolLocalDepth(depth int) {
+	keyPoolLocalDepth.Set(float64(depth))
+}
+
+func SetKeyPoolAvailable(available int64) {
+	keyPoolAvailable.Set(float64(available))
+}
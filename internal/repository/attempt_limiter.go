@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisAttemptLimiter counts attempts per key in Redis so every server
+// process shares the same lockout. The window starts at the first attempt;
+// once maxAttempts attempts are counted without a Reset, the key stays
+// blocked until it ends.
+type RedisAttemptLimiter struct {
+	redis       *redis.Client
+	prefix      string
+	maxAttempts int64
+	window      time.Duration
+}
+
+func NewRedisAttemptLimiter(redisClient *redis.Client, prefix string, maxAttempts int, window time.Duration) *RedisAttemptLimiter {
+	return &RedisAttemptLimiter{
+		redis:       redisClient,
+		prefix:      prefix,
+		maxAttempts: int64(maxAttempts),
+		window:      window,
+	}
+}
+
+// Attempt counts an attempt, starts the window with the first one and reads
+// what is left of it, all in one transaction: parallel attempts each get
+// their own count, and a counter is never left without a window.
+func (l *RedisAttemptLimiter) Attempt(ctx context.Context, key string) (time.Duration, error) {
+	pipe := l.redis.TxPipeline()
+	count := pipe.Incr(ctx, l.getKey(key))
+	pipe.ExpireNX(ctx, l.getKey(key), l.window)
+	ttl := pipe.PTTL(ctx, l.getKey(key))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to record attempt: %w", err)
+	}
+	if count.Val() <= l.maxAttempts {
+		return 0, nil
+	}
+	return ttl.Val(), nil
+}
+
+func (l *RedisAttemptLimiter) Reset(ctx context.Context, key string) error {
+	return l.redis.Del(ctx, l.getKey(key)).Err()
+}
+
+func (l *RedisAttemptLimiter) getKey(key string) string {
+	return fmt.Sprintf("%s:%s", l.prefix, key)
+}
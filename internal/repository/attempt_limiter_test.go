@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestAttemptLimiter(t *testing.T, maxAttempts int, window time.Duration) (*RedisAttemptLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	return NewRedisAttemptLimiter(client, "password:attempts", maxAttempts, window), server
+}
+
+func TestRedisAttemptLimiter(t *testing.T) {
+	limiter, server := newTestAttemptLimiter(t, 2, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		blocked, err := limiter.Attempt(ctx, "abc")
+		if err != nil {
+			t.Fatalf("Erro inesperado ao registrar tentativa: %v", err)
+		}
+		if blocked != 0 {
+			t.Fatalf("Tentativa %d deveria ser permitida, bloqueio obtido %v", i+1, blocked)
+		}
+		server.FastForward(10 * time.Second)
+	}
+
+	blocked, err := limiter.Attempt(ctx, "abc")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao registrar tentativa: %v", err)
+	}
+	if blocked != 40*time.Second {
+		t.Errorf("Bloqueio deveria durar até o fim da janela iniciada na primeira tentativa (40s), obtido %v", blocked)
+	}
+
+	server.FastForward(40 * time.Second)
+	if blocked, _ := limiter.Attempt(ctx, "abc"); blocked != 0 {
+		t.Errorf("Bloqueio deveria acabar com a janela, obtido %v", blocked)
+	}
+
+	if err := limiter.Reset(ctx, "abc"); err != nil {
+		t.Fatalf("Erro inesperado ao zerar tentativas: %v", err)
+	}
+	if server.Exists("password:attempts:abc") {
+		t.Error("Reset deveria remover o contador")
+	}
+}
+
+func TestRedisAttemptLimiterConcurrent(t *testing.T) {
+	limiter, _ := newTestAttemptLimiter(t, 5, time.Minute)
+	ctx := context.Background()
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blocked, err := limiter.Attempt(ctx, "abc")
+			if err != nil {
+				t.Errorf("Erro inesperado ao registrar tentativa: %v", err)
+				return
+			}
+			if blocked == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != 5 {
+		t.Errorf("Esperado exatamente 5 tentativas permitidas, obtido %d", allowed.Load())
+	}
+}
+
+func TestRedisAttemptLimiterWithoutWindow(t *testing.T) {
+	limiter, server := newTestAttemptLimiter(t, 2, time.Minute)
+	ctx := context.Background()
+
+	// A counter left without a TTL, as an interrupted INCR + EXPIRE did.
+	server.Set("password:attempts:abc", "5")
+
+	blocked, err := limiter.Attempt(ctx, "abc")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao registrar tentativa: %v", err)
+	}
+	if blocked != time.Minute {
+		t.Errorf("Bloqueio esperado de 1m, obtido %v", blocked)
+	}
+	if ttl := server.TTL("password:attempts:abc"); ttl != time.Minute {
+		t.Fatalf("Contador sem janela deveria receber uma, TTL obtido %v", ttl)
+	}
+
+	server.FastForward(time.Minute)
+	if blocked, _ := limiter.Attempt(ctx, "abc"); blocked != 0 {
+		t.Errorf("Bloqueio não deveria ser permanente, obtido %v", blocked)
+	}
+}
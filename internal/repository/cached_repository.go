@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -27,29 +28,76 @@ func NewCachedRepository(db *gorm.DB, redisClient *redis.Client, baseURL string,
 	}
 }
 
-func (r *CachedRepository) Save(ctx context.Context, url *domain.URL) error {
-
-	if err := r.saveToDatabase(ctx, url); err != nil {
+func (r *CachedRepository) Create(ctx context.Context, url *domain.URL) error {
+	if err := r.createInDatabase(ctx, url); err != nil {
 		return err
 	}
 
 	return r.saveToCache(ctx, url)
 }
 
-func (r *CachedRepository) FindByShortURL(ctx context.Context, shortCode string) (*domain.URL, error) {
+func (r *CachedRepository) Update(ctx context.Context, url *domain.URL, audit *domain.AuditEntry) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.URL{}).
+			Where("domain = ? AND short_url = ?", url.Domain, url.ShortURL).
+			Updates(map[string]interface{}{
+				"long_url":         url.LongURL,
+				"long_url_hash":    url.LongURLHash,
+				"title":            url.Title,
+				"description":      url.Description,
+				"image_url":        url.ImageURL,
+				"redirect_type":    url.RedirectType,
+				"password_hash":    url.PasswordHash,
+				"max_clicks":       url.MaxClicks,
+				"query_merge":      url.QueryMerge,
+				"path_passthrough": url.PathPassthrough,
+				"utm_source":       url.UTM.Source,
+				"utm_medium":       url.UTM.Medium,
+				"utm_campaign":     url.UTM.Campaign,
+				"utm_term":         url.UTM.Term,
+				"utm_content":      url.UTM.Content,
+				"preview":          url.Preview,
+				"expires_at":       url.ExpiresAt,
+				"activates_at":     url.ActivatesAt,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update URL: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrNotFound
+		}
+		if err := replaceRules(tx, url); err != nil {
+			return err
+		}
+		if err := replaceVariants(tx, url); err != nil {
+			return err
+		}
+		if err := tx.Create(audit).Error; err != nil {
+			return fmt.Errorf("failed to record audit entry: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.deleteFromCache(ctx, url.Domain, url.ShortURL)
+}
+
+func (r *CachedRepository) FindByShortURL(ctx context.Context, host, shortCode string) (*domain.URL, error) {
 
-	url, err := r.findInCache(ctx, shortCode)
+	url, err := r.findInCache(ctx, host, shortCode)
 	if err == nil {
 		return url, nil
 	}
 
-	url, err = r.findInDatabase(ctx, shortCode)
+	url, ttl, err := r.findInDatabase(ctx, host, shortCode, time.Now())
 	if err != nil {
 		return nil, err
 	}
 
-	if url.ExpiresAt.After(time.Now()) {
-		if err := r.saveToCache(ctx, url); err != nil {
+	if ttl > 0 {
+		if err := r.cacheFor(ctx, url, ttl); err != nil {
 			fmt.Printf("Failed to save to cache: %v\n", err)
 		}
 	}
@@ -57,65 +105,234 @@ func (r *CachedRepository) FindByShortURL(ctx context.Context, shortCode string)
 	return url, nil
 }
 
-func (r *CachedRepository) Delete(ctx context.Context, shortCode string) error {
-	if err := r.deleteFromDatabase(ctx, shortCode); err != nil {
+func (r *CachedRepository) FindByLongURLHash(ctx context.Context, host, hash string, owner *string) (*domain.URL, error) {
+	var url domain.URL
+	query := r.db.WithContext(ctx).
+		Where("domain = ? AND long_url_hash = ?", host, hash).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Where("activates_at IS NULL OR activates_at <= ?", time.Now()).
+		Where("password_hash IS NULL OR password_hash = ''").
+		Where("COALESCE(max_clicks, 0) = 0").
+		Where("(redirect_type IS NULL OR redirect_type = 0) AND COALESCE(title, '') = '' AND COALESCE(description, '') = '' AND COALESCE(image_url, '') = ''").
+		Where("NOT EXISTS (SELECT 1 FROM url_targeting_rules WHERE url_targeting_rules.url_id = shorten_url.id)").
+		Where("NOT EXISTS (SELECT 1 FROM url_variants WHERE url_variants.url_id = shorten_url.id)").
+		Where("(query_merge IS NULL OR query_merge = '') AND NOT path_passthrough AND NOT preview").
+		Where("CONCAT(utm_source, utm_medium, utm_campaign, utm_term, utm_content) = ''")
+	if owner != nil {
+		query = query.Where("owner = ?", *owner)
+	}
+	result := query.Order("created_at DESC").First(&url)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get URL: %w", result.Error)
+	}
+	return &url, nil
+}
+
+func (r *CachedRepository) Delete(ctx context.Context, host, shortCode string) error {
+	if err := r.deleteFromDatabase(ctx, host, shortCode); err != nil {
 		return err
 	}
-	return r.deleteFromCache(ctx, shortCode)
+	return r.deleteFromCache(ctx, host, shortCode)
+}
+
+func (r *CachedRepository) List(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	query := r.db.WithContext(ctx)
+	if filter.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if filter.Owner != nil {
+		query = query.Where("owner = ?", *filter.Owner)
+	}
+
+	var urls []*domain.URL
+	result := query.Preload("Rules", orderByPosition).Preload("Variants", orderByPosition).Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&urls)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list URLs: %w", result.Error)
+	}
+	return urls, nil
+}
+
+func (r *CachedRepository) Restore(ctx context.Context, host, shortCode string) error {
+	result := r.db.WithContext(ctx).Unscoped().Model(&domain.URL{}).
+		Where("domain = ? AND short_url = ? AND deleted_at IS NOT NULL", host, shortCode).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to restore URL: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *CachedRepository) Purge(ctx context.Context, host, shortCode string) error {
+	result := r.db.WithContext(ctx).Unscoped().Where("domain = ? AND short_url = ?", host, shortCode).Delete(&domain.URL{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge URL: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return r.deleteFromCache(ctx, host, shortCode)
+}
+
+// RecordAccesses adds the batched visits to the stored counters. Cached links
+// keep the counts they were cached with; FindAccess reads the current ones.
+func (r *CachedRepository) RecordAccesses(ctx context.Context, batches []domain.AccessBatch) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, batch := range batches {
+			err := tx.Model(&domain.URL{}).
+				Where("domain = ? AND short_url = ?", batch.Domain, batch.ShortURL).
+				Updates(map[string]interface{}{
+					"access_count":     gorm.Expr("access_count + ?", batch.Count),
+					"last_accessed_at": gorm.Expr("GREATEST(COALESCE(last_accessed_at, ?), ?)", batch.LastAccessedAt, batch.LastAccessedAt),
+				}).Error
+			if err != nil {
+				return fmt.Errorf("failed to record access for %s: %w", batch.ShortURL, err)
+			}
+		}
+		return nil
+	})
 }
 
-func (r *CachedRepository) saveToDatabase(ctx context.Context, url *domain.URL) error {
-	var existingURL domain.URL
-	result := r.db.WithContext(ctx).Where("short_url = ?", url.ShortURL).First(&existingURL)
+func (r *CachedRepository) FindAccess(ctx context.Context, host, shortCode string) (int64, *time.Time, error) {
+	var url domain.URL
+	result := r.db.WithContext(ctx).Select("access_count", "last_accessed_at").Where("domain = ? AND short_url = ?", host, shortCode).First(&url)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			return r.db.WithContext(ctx).Create(url).Error
+			return 0, nil, domain.ErrNotFound
+		}
+		return 0, nil, fmt.Errorf("failed to get access counts: %w", result.Error)
+	}
+	return url.AccessCount, url.LastAccessedAt, nil
+}
+
+func (r *CachedRepository) createInDatabase(ctx context.Context, url *domain.URL) error {
+	if err := r.db.WithContext(ctx).Create(url).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return domain.ErrShortURLTaken
 		}
-		return fmt.Errorf("failed to check existing URL: %w", result.Error)
+		return fmt.Errorf("failed to create URL: %w", err)
 	}
-	existingURL.LongURL = url.LongURL
-	existingURL.ExpiresAt = url.ExpiresAt
-	return r.db.WithContext(ctx).Save(&existingURL).Error
+	return nil
 }
 
-func (r *CachedRepository) findInDatabase(ctx context.Context, shortCode string) (*domain.URL, error) {
+// findInDatabase loads a link together with how long it may be cached as
+// read at now: not past its activation or expiry, and not at all once it
+// has expired.
+func (r *CachedRepository) findInDatabase(ctx context.Context, host, shortCode string, now time.Time) (*domain.URL, time.Duration, error) {
 	var url domain.URL
-	result := r.db.WithContext(ctx).Where("short_url = ? AND expires_at > ?", shortCode, time.Now()).First(&url)
+	result := r.db.WithContext(ctx).Unscoped().Preload("Rules", orderByPosition).Preload("Variants", orderByPosition).Where("domain = ? AND short_url = ?", host, shortCode).First(&url)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("URL not found or expired")
+			return nil, 0, domain.ErrNotFound
 		}
-		return nil, fmt.Errorf("failed to get URL: %w", result.Error)
+		return nil, 0, fmt.Errorf("failed to get URL: %w", result.Error)
 	}
-	return &url, nil
+	if url.DeletedAt.Valid {
+		return nil, 0, domain.ErrDeleted
+	}
+	return &url, r.cacheTTLFor(&url, now), nil
+}
+
+func orderByPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// replaceRules swaps the stored targeting rules of a link for url.Rules.
+func replaceRules(tx *gorm.DB, url *domain.URL) error {
+	if err := tx.Where("url_id = ?", url.ID).Delete(&domain.TargetingRule{}).Error; err != nil {
+		return fmt.Errorf("failed to delete targeting rules: %w", err)
+	}
+	if len(url.Rules) == 0 {
+		return nil
+	}
+
+	rules := make([]domain.TargetingRule, len(url.Rules))
+	for i, rule := range url.Rules {
+		rule.ID = 0
+		rule.URLID = url.ID
+		rule.Position = i
+		rules[i] = rule
+	}
+	if err := tx.Create(&rules).Error; err != nil {
+		return fmt.Errorf("failed to save targeting rules: %w", err)
+	}
+	return nil
+}
+
+// replaceVariants swaps the stored A/B variants of a link for url.Variants.
+func replaceVariants(tx *gorm.DB, url *domain.URL) error {
+	if err := tx.Where("url_id = ?", url.ID).Delete(&domain.Variant{}).Error; err != nil {
+		return fmt.Errorf("failed to delete variants: %w", err)
+	}
+	if len(url.Variants) == 0 {
+		return nil
+	}
+
+	variants := make([]domain.Variant, len(url.Variants))
+	for i, variant := range url.Variants {
+		variant.ID = 0
+		variant.URLID = url.ID
+		variant.Position = i
+		variants[i] = variant
+	}
+	if err := tx.Create(&variants).Error; err != nil {
+		return fmt.Errorf("failed to save variants: %w", err)
+	}
+	return nil
 }
 
-func (r *CachedRepository) deleteFromDatabase(ctx context.Context, shortCode string) error {
-	result := r.db.WithContext(ctx).Where("short_url = ?", shortCode).Delete(&domain.URL{})
+func (r *CachedRepository) deleteFromDatabase(ctx context.Context, host, shortCode string) error {
+	result := r.db.WithContext(ctx).Where("domain = ? AND short_url = ?", host, shortCode).Delete(&domain.URL{})
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete URL: %w", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("URL not found")
+		return domain.ErrNotFound
 	}
 	return nil
 }
 
 func (r *CachedRepository) saveToCache(ctx context.Context, url *domain.URL) error {
+	ttl := r.cacheTTLFor(url, time.Now())
+	if ttl <= 0 {
+		return r.deleteFromCache(ctx, url.Domain, url.ShortURL)
+	}
+	return r.cacheFor(ctx, url, ttl)
+}
+
+func (r *CachedRepository) cacheFor(ctx context.Context, url *domain.URL, ttl time.Duration) error {
 	data, err := json.Marshal(url)
 	if err != nil {
 		return fmt.Errorf("failed to marshal URL: %w", err)
 	}
-	key := r.getCacheKey(url.ShortURL)
-	ttl := time.Until(url.ExpiresAt)
-	if ttl > r.cacheTTL {
-		ttl = r.cacheTTL
+	return r.redis.Set(ctx, r.getCacheKey(url.Domain, url.ShortURL), data, ttl).Err()
+}
+
+// cacheTTLFor keeps an entry no longer than the link's current state lasts:
+// a scheduled link is dropped when it activates and a live one when it
+// expires, so a cached entry never outlives the window it was read in.
+func (r *CachedRepository) cacheTTLFor(url *domain.URL, now time.Time) time.Duration {
+	ttl := r.cacheTTL
+	if url.ActivatesAt != nil && now.Before(*url.ActivatesAt) {
+		if untilActive := url.ActivatesAt.Sub(now); untilActive < ttl {
+			ttl = untilActive
+		}
+	}
+	if url.ExpiresAt != nil {
+		if remaining := url.ExpiresAt.Sub(now); remaining < ttl {
+			ttl = remaining
+		}
 	}
-	return r.redis.Set(ctx, key, data, ttl).Err()
+	return ttl
 }
 
-func (r *CachedRepository) findInCache(ctx context.Context, shortCode string) (*domain.URL, error) {
-	key := r.getCacheKey(shortCode)
+func (r *CachedRepository) findInCache(ctx context.Context, host, shortCode string) (*domain.URL, error) {
+	key := r.getCacheKey(host, shortCode)
 	data, err := r.redis.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
@@ -130,11 +347,11 @@ func (r *CachedRepository) findInCache(ctx context.Context, shortCode string) (*
 	return &url, nil
 }
 
-func (r *CachedRepository) deleteFromCache(ctx context.Context, shortCode string) error {
-	key := r.getCacheKey(shortCode)
+func (r *CachedRepository) deleteFromCache(ctx context.Context, host, shortCode string) error {
+	key := r.getCacheKey(host, shortCode)
 	return r.redis.Del(ctx, key).Err()
 }
 
-func (r *CachedRepository) getCacheKey(shortCode string) string {
-	return fmt.Sprintf("url:%s", shortCode)
+func (r *CachedRepository) getCacheKey(host, shortCode string) string {
+	return fmt.Sprintf("url:%s", domain.LinkKey(host, shortCode))
 }
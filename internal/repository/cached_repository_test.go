@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+func TestCacheTTLFor(t *testing.T) {
+	repo := &CachedRepository{cacheTTL: 24 * time.Hour}
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		instant := now.Add(d)
+		return &instant
+	}
+
+	tests := []struct {
+		name string
+		url  domain.URL
+		want time.Duration
+	}{
+		{"Link permanente", domain.URL{}, 24 * time.Hour},
+		{"Expira antes do TTL do cache", domain.URL{ExpiresAt: at(time.Hour)}, time.Hour},
+		{"Agendado fica em cache só até ativar", domain.URL{ActivatesAt: at(10 * time.Minute), ExpiresAt: at(time.Hour)}, 10 * time.Minute},
+		{"Já ativo", domain.URL{ActivatesAt: at(-time.Minute), ExpiresAt: at(time.Hour)}, time.Hour},
+		{"Expirado", domain.URL{ExpiresAt: at(-time.Minute)}, -time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := repo.cacheTTLFor(&tt.url, now); got != tt.want {
+			t.Errorf("%s: TTL esperado %v, obtido %v", tt.name, tt.want, got)
+		}
+	}
+}
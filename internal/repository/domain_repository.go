@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+	"gorm.io/gorm"
+)
+
+type DomainRepository struct {
+	db *gorm.DB
+}
+
+func NewDomainRepository(db *gorm.DB) *DomainRepository {
+	return &DomainRepository{db: db}
+}
+
+func (r *DomainRepository) List(ctx context.Context) ([]domain.ShortDomain, error) {
+	var domains []domain.ShortDomain
+	if err := r.db.WithContext(ctx).Order("host").Find(&domains).Error; err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+	return domains, nil
+}
+
+func (r *DomainRepository) Add(ctx context.Context, shortDomain *domain.ShortDomain) error {
+	if err := r.db.WithContext(ctx).Create(shortDomain).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return domain.ErrDomainTaken
+		}
+		return fmt.Errorf("failed to add domain: %w", err)
+	}
+	return nil
+}
+
+func (r *DomainRepository) Remove(ctx context.Context, host string) error {
+	result := r.db.WithContext(ctx).Where("host = ?", host).Delete(&domain.ShortDomain{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove domain: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type KeyPoolRepository struct {
+	db *gorm.DB
+}
+
+func NewKeyPoolRepository(db *gorm.DB) *KeyPoolRepository {
+	return &KeyPoolRepository{db: db}
+}
+
+func (r *KeyPoolRepository) Insert(ctx context.Context, codes []string) (int64, error) {
+	var taken []string
+	if err := r.db.WithContext(ctx).Unscoped().Model(&domain.URL{}).
+		Where("short_url IN ?", codes).
+		Pluck("short_url", &taken).Error; err != nil {
+		return 0, fmt.Errorf("failed to check existing codes: %w", err)
+	}
+
+	skip := make(map[string]bool, len(taken))
+	for _, code := range taken {
+		skip[code] = true
+	}
+
+	now := time.Now()
+	keys := make([]domain.ShortCodeKey, 0, len(codes))
+	for _, code := range codes {
+		if !skip[code] {
+			keys = append(keys, domain.ShortCodeKey{Code: code, CreatedAt: now})
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&keys, 1000)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to insert pool keys: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (r *KeyPoolRepository) Lease(ctx context.Context, owner string, count int, ttl time.Duration) ([]string, error) {
+	var codes []string
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE short_code_pool SET leased_by = ?, lease_expires_at = ?
+		WHERE code IN (
+			SELECT code FROM short_code_pool
+			WHERE leased_by IS NULL
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING code`, owner, time.Now().Add(ttl), count).Scan(&codes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease pool keys: %w", err)
+	}
+	return codes, nil
+}
+
+func (r *KeyPoolRepository) Renew(ctx context.Context, owner string, ttl time.Duration) error {
+	err := r.db.WithContext(ctx).Model(&domain.ShortCodeKey{}).
+		Where("leased_by = ?", owner).
+		Update("lease_expires_at", time.Now().Add(ttl)).Error
+	if err != nil {
+		return fmt.Errorf("failed to renew pool lease: %w", err)
+	}
+	return nil
+}
+
+func (r *KeyPoolRepository) Consume(ctx context.Context, codes []string) error {
+	if err := r.db.WithContext(ctx).Where("code IN ?", codes).Delete(&domain.ShortCodeKey{}).Error; err != nil {
+		return fmt.Errorf("failed to consume pool keys: %w", err)
+	}
+	return nil
+}
+
+func (r *KeyPoolRepository) Release(ctx context.Context, owner string) error {
+	err := r.db.WithContext(ctx).Model(&domain.ShortCodeKey{}).
+		Where("leased_by = ?", owner).
+		Updates(map[string]interface{}{"leased_by": nil, "lease_expires_at": nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release pool lease: %w", err)
+	}
+	return nil
+}
+
+func (r *KeyPoolRepository) ReclaimExpired(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&domain.ShortCodeKey{}).
+		Where("leased_by IS NOT NULL AND lease_expires_at < ?", time.Now()).
+		Updates(map[string]interface{}{"leased_by": nil, "lease_expires_at": nil})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to reclaim expired leases: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (r *KeyPoolRepository) CountAvailable(ctx context.Context) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&domain.ShortCodeKey{}).Where("leased_by IS NULL").Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count pool keys: %w", err)
+	}
+	return count, nil
+}
@@ -45,7 +45,7 @@ func (r *PostgresRepository) Save(url *domain.URL) error {
 func (r *PostgresRepository) FindByShortURL(shortCode string) (*domain.URL, error) {
 	var url domain.URL
 	result := r.db.WithContext(context.Background()).
-		Where("short_url = ? AND expires_at > ?", shortCode, time.Now()).
+		Where("short_url = ? AND (expires_at IS NULL OR expires_at > ?)", shortCode, time.Now()).
 		First(&url)
 
 	if result.Error != nil {
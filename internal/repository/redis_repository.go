@@ -33,9 +33,12 @@ func (r *RedisRepository) Save(url *domain.URL) error {
 	shortCode := strings.TrimPrefix(url.ShortURL, r.baseURL+"/")
 	key := fmt.Sprintf("url:%s", shortCode)
 
-	expiration := time.Until(url.ExpiresAt)
-	if expiration < 0 {
-		expiration = 0
+	var expiration time.Duration
+	if url.ExpiresAt != nil {
+		expiration = time.Until(*url.ExpiresAt)
+		if expiration <= 0 {
+			return nil
+		}
 	}
 
 	return r.client.Set(ctx, key, data, expiration).Err()
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const ShortCodeSequence = "short_code_seq"
+
+type PostgresSequence struct {
+	db   *gorm.DB
+	name string
+}
+
+func NewPostgresSequence(db *gorm.DB, name string) *PostgresSequence {
+	return &PostgresSequence{
+		db:   db,
+		name: name,
+	}
+}
+
+func (s *PostgresSequence) NextValue(ctx context.Context) (uint64, error) {
+	var value uint64
+	if err := s.db.WithContext(ctx).Raw("SELECT nextval(?::regclass)", s.name).Scan(&value).Error; err != nil {
+		return 0, fmt.Errorf("failed to read sequence %s: %w", s.name, err)
+	}
+	return value, nil
+}
+
+func (s *PostgresSequence) NextValues(ctx context.Context, n int) ([]uint64, error) {
+	var values []uint64
+	if err := s.db.WithContext(ctx).Raw("SELECT nextval(?::regclass) FROM generate_series(1, ?)", s.name, n).Scan(&values).Error; err != nil {
+		return nil, fmt.Errorf("failed to read sequence %s: %w", s.name, err)
+	}
+	return values, nil
+}
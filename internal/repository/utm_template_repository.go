@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UTMTemplateRepository struct {
+	db *gorm.DB
+}
+
+func NewUTMTemplateRepository(db *gorm.DB) *UTMTemplateRepository {
+	return &UTMTemplateRepository{db: db}
+}
+
+func (r *UTMTemplateRepository) Find(ctx context.Context, owner string) (*domain.UTMTemplate, error) {
+	var template domain.UTMTemplate
+	if err := r.db.WithContext(ctx).Where("owner = ?", owner).First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get UTM template: %w", err)
+	}
+	return &template, nil
+}
+
+func (r *UTMTemplateRepository) Save(ctx context.Context, template *domain.UTMTemplate) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(template).Error
+	if err != nil {
+		return fmt.Errorf("failed to save UTM template: %w", err)
+	}
+	return nil
+}
+
+func (r *UTMTemplateRepository) Delete(ctx context.Context, owner string) error {
+	result := r.db.WithContext(ctx).Where("owner = ?", owner).Delete(&domain.UTMTemplate{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete UTM template: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+type AccessStore interface {
+	RecordAccesses(ctx context.Context, batches []domain.AccessBatch) error
+}
+
+// AccessRecorder counts link visits in memory and writes them to the store in
+// batches, keeping the redirect path free of database writes.
+type AccessRecorder struct {
+	store    AccessStore
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*domain.AccessBatch
+
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+func NewAccessRecorder(store AccessStore, interval time.Duration) *AccessRecorder {
+	return &AccessRecorder{
+		store:    store,
+		interval: interval,
+		pending:  make(map[string]*domain.AccessBatch),
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *AccessRecorder) Record(host, shortCode string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := domain.LinkKey(host, shortCode)
+	batch, ok := r.pending[key]
+	if !ok {
+		batch = &domain.AccessBatch{Domain: host, ShortURL: shortCode}
+		r.pending[key] = batch
+	}
+	batch.Count++
+	if at.After(batch.LastAccessedAt) {
+		batch.LastAccessedAt = at
+	}
+}
+
+func (r *AccessRecorder) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.Flush(ctx); err != nil {
+					log.Printf("Failed to flush access counts: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the background flush and writes whatever is still pending.
+func (r *AccessRecorder) Close(ctx context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+		<-r.done
+	}
+	return r.Flush(ctx)
+}
+
+func (r *AccessRecorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]*domain.AccessBatch)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	batches := make([]domain.AccessBatch, 0, len(pending))
+	for _, batch := range pending {
+		batches = append(batches, *batch)
+	}
+
+	if err := r.store.RecordAccesses(ctx, batches); err != nil {
+		r.requeue(batches)
+		return err
+	}
+	return nil
+}
+
+func (r *AccessRecorder) requeue(batches []domain.AccessBatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, failed := range batches {
+		key := domain.LinkKey(failed.Domain, failed.ShortURL)
+		batch, ok := r.pending[key]
+		if !ok {
+			failed := failed
+			r.pending[key] = &failed
+			continue
+		}
+		batch.Count += failed.Count
+		if failed.LastAccessedAt.After(batch.LastAccessedAt) {
+			batch.LastAccessedAt = failed.LastAccessedAt
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+type flakyAccessStore struct {
+	fail    bool
+	batches []domain.AccessBatch
+}
+
+func (s *flakyAccessStore) RecordAccesses(ctx context.Context, batches []domain.AccessBatch) error {
+	if s.fail {
+		return errors.New("database unavailable")
+	}
+	s.batches = append(s.batches, batches...)
+	return nil
+}
+
+func TestAccessRecorderRequeuesOnFailure(t *testing.T) {
+	store := &flakyAccessStore{fail: true}
+	recorder := NewAccessRecorder(store, time.Hour)
+
+	first := time.Now()
+	recorder.Record("", "abc", first)
+	recorder.Record("", "abc", first.Add(time.Second))
+
+	if err := recorder.Flush(context.Background()); err == nil {
+		t.Fatal("Esperado erro no flush com banco indisponível")
+	}
+
+	recorder.Record("", "abc", first.Add(2*time.Second))
+	store.fail = false
+
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatalf("Erro inesperado ao fechar: %v", err)
+	}
+
+	if len(store.batches) != 1 {
+		t.Fatalf("Esperado 1 lote, obtidos %d", len(store.batches))
+	}
+	batch := store.batches[0]
+	if batch.Count != 3 {
+		t.Errorf("Esperado 3 acessos, obtidos %d", batch.Count)
+	}
+	if !batch.LastAccessedAt.Equal(first.Add(2 * time.Second)) {
+		t.Errorf("Último acesso inesperado: %s", batch.LastAccessedAt)
+	}
+}
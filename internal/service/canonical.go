@@ -0,0 +1,46 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// canonicalizeURL normalizes the parts of a URL that do not change the
+// destination, so equivalent long URLs hash to the same value.
+func canonicalizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host = host + ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawPath = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.RawQuery = u.Query().Encode()
+
+	return u.String()
+}
+
+func hashURL(rawURL string) string {
+	sum := sha256.Sum256([]byte(canonicalizeURL(rawURL)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+var ErrInvalidMaxClicks = errors.New("max_clicks must not be negative")
+
+// ClickCounter keeps the shared per-link redirect count that enforces
+// max_clicks. Links are identified by domain.LinkKey.
+type ClickCounter interface {
+	Clicks(ctx context.Context, key string) (int64, error)
+	IncrementClicks(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// ExpireClicks moves the count's expiry to ttl from now; zero keeps it
+	// until it is reset.
+	ExpireClicks(ctx context.Context, key string, ttl time.Duration) error
+	// ResetLinkCounters drops the click count together with the link's
+	// analytics, for a code that is about to be reissued.
+	ResetLinkCounters(ctx context.Context, key string) error
+}
+
+// WithClickCounter enforces max_clicks on redirects. Without a counter the
+// limit is stored but not enforced.
+func WithClickCounter(counter ClickCounter) Option {
+	return func(s *URLService) {
+		s.clicks = counter
+	}
+}
+
+func validateMaxClicks(maxClicks int64) error {
+	if maxClicks < 0 {
+		return ErrInvalidMaxClicks
+	}
+	return nil
+}
+
+// claimClick reserves one of the link's remaining clicks. The counter is
+// incremented before the redirect is served, so concurrent visitors can
+// never get more than MaxClicks redirects between them.
+func (s *URLService) claimClick(ctx context.Context, shortCode string, url *domain.URL) error {
+	if !url.HasClickLimit() || s.clicks == nil {
+		return nil
+	}
+
+	count, err := s.clicks.IncrementClicks(ctx, domain.LinkKey(url.Domain, shortCode), clicksTTL(url))
+	if err != nil {
+		return fmt.Errorf("failed to claim click: %w", err)
+	}
+	if count > url.MaxClicks {
+		return domain.ErrExhausted
+	}
+	return nil
+}
+
+// checkClicks fails with domain.ErrExhausted when the link has no clicks
+// left, without using one up.
+func (s *URLService) checkClicks(ctx context.Context, shortCode string, url *domain.URL) error {
+	if !url.HasClickLimit() || s.clicks == nil {
+		return nil
+	}
+
+	count, err := s.clicks.Clicks(ctx, domain.LinkKey(url.Domain, shortCode))
+	if err != nil {
+		return fmt.Errorf("failed to read click count: %w", err)
+	}
+	if count >= url.MaxClicks {
+		return domain.ErrExhausted
+	}
+	return nil
+}
+
+// expireClicks makes the link's click count expire with the link again after
+// its expiry changed, so extending a link does not reset its limit early.
+func (s *URLService) expireClicks(ctx context.Context, shortCode string, url *domain.URL) error {
+	if !url.HasClickLimit() || s.clicks == nil {
+		return nil
+	}
+
+	if err := s.clicks.ExpireClicks(ctx, domain.LinkKey(url.Domain, shortCode), clicksTTL(url)); err != nil {
+		return fmt.Errorf("failed to update click count expiry: %w", err)
+	}
+	return nil
+}
+
+// clicksTTL is how long the link's click count must be kept: until the link
+// expires, or for good when it never does.
+func clicksTTL(url *domain.URL) time.Duration {
+	if url.ExpiresAt == nil {
+		return 0
+	}
+	return max(time.Until(*url.ExpiresAt), 0)
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	minObfuscatedLength = 4
+	maxObfuscatedLength = 10
+	feistelRounds       = 4
+)
+
+type CodeGenerator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// SequenceSource hands out monotonically increasing values, e.g. a Postgres sequence.
+type SequenceSource interface {
+	NextValue(ctx context.Context) (uint64, error)
+	// NextValues reserves n values in a single round-trip.
+	NextValues(ctx context.Context, n int) ([]uint64, error)
+}
+
+// BatchCodeGenerator is implemented by generators that can produce many codes
+// more cheaply than by calling Generate once per code.
+type BatchCodeGenerator interface {
+	GenerateBatch(ctx context.Context, n int) ([]string, error)
+}
+
+type RandomCodeGenerator struct {
+	length int
+}
+
+func NewRandomCodeGenerator(length int) *RandomCodeGenerator {
+	return &RandomCodeGenerator{length: length}
+}
+
+func (g *RandomCodeGenerator) Generate(ctx context.Context) (string, error) {
+	code := make([]byte, 0, g.length)
+	buf := make([]byte, g.length*2)
+	for len(code) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			// 248 is the largest multiple of 62 below 256, so rejecting
+			// anything above it keeps every character equally likely.
+			if b >= 248 {
+				continue
+			}
+			code = append(code, base62Alphabet[int(b)%62])
+			if len(code) == g.length {
+				break
+			}
+		}
+	}
+	return string(code), nil
+}
+
+type SequenceCodeGenerator struct {
+	seq SequenceSource
+}
+
+func NewSequenceCodeGenerator(seq SequenceSource) *SequenceCodeGenerator {
+	return &SequenceCodeGenerator{seq: seq}
+}
+
+func (g *SequenceCodeGenerator) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.NextValue(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get next sequence value: %w", err)
+	}
+	return encodeBase62(n, 0), nil
+}
+
+func (g *SequenceCodeGenerator) GenerateBatch(ctx context.Context, n int) ([]string, error) {
+	values, err := g.seq.NextValues(ctx, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next sequence values: %w", err)
+	}
+	codes := make([]string, 0, len(values))
+	for _, v := range values {
+		codes = append(codes, encodeBase62(v, 0))
+	}
+	return codes, nil
+}
+
+// ObfuscatedCodeGenerator maps a counter through a keyed Feistel permutation
+// over [0, 62^length), so codes are unique and reversible with the secret
+// but consecutive values do not produce guessable neighbours.
+type ObfuscatedCodeGenerator struct {
+	seq    SequenceSource
+	length int
+	space  uint64
+	half   uint
+	key    []byte
+}
+
+func NewObfuscatedCodeGenerator(seq SequenceSource, length int, secret string) (*ObfuscatedCodeGenerator, error) {
+	if length < minObfuscatedLength || length > maxObfuscatedLength {
+		return nil, fmt.Errorf("obfuscated code length must be between %d and %d", minObfuscatedLength, maxObfuscatedLength)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("obfuscated code generator requires a secret")
+	}
+
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		space *= 62
+	}
+	domainBits := uint(bits.Len64(space - 1))
+	if domainBits%2 != 0 {
+		domainBits++
+	}
+
+	return &ObfuscatedCodeGenerator{
+		seq:    seq,
+		length: length,
+		space:  space,
+		half:   domainBits / 2,
+		key:    []byte(secret),
+	}, nil
+}
+
+func (g *ObfuscatedCodeGenerator) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.NextValue(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get next sequence value: %w", err)
+	}
+	return g.Encode(n)
+}
+
+func (g *ObfuscatedCodeGenerator) GenerateBatch(ctx context.Context, n int) ([]string, error) {
+	values, err := g.seq.NextValues(ctx, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next sequence values: %w", err)
+	}
+	codes := make([]string, 0, len(values))
+	for _, v := range values {
+		code, err := g.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func (g *ObfuscatedCodeGenerator) Encode(n uint64) (string, error) {
+	if n >= g.space {
+		return "", fmt.Errorf("counter %d exceeds the %d-character code space", n, g.length)
+	}
+	v := n
+	for {
+		v = g.permute(v)
+		if v < g.space {
+			return encodeBase62(v, g.length), nil
+		}
+	}
+}
+
+func (g *ObfuscatedCodeGenerator) Decode(code string) (uint64, error) {
+	if len(code) != g.length {
+		return 0, fmt.Errorf("code must have %d characters", g.length)
+	}
+	v, err := decodeBase62(code)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		v = g.unpermute(v)
+		if v < g.space {
+			return v, nil
+		}
+	}
+}
+
+func (g *ObfuscatedCodeGenerator) permute(v uint64) uint64 {
+	mask := uint64(1)<<g.half - 1
+	l, r := v>>g.half, v&mask
+	for i := 0; i < feistelRounds; i++ {
+		l, r = r, l^(g.round(i, r)&mask)
+	}
+	return l<<g.half | r
+}
+
+func (g *ObfuscatedCodeGenerator) unpermute(v uint64) uint64 {
+	mask := uint64(1)<<g.half - 1
+	l, r := v>>g.half, v&mask
+	for i := feistelRounds - 1; i >= 0; i-- {
+		l, r = r^(g.round(i, l)&mask), l
+	}
+	return l<<g.half | r
+}
+
+func (g *ObfuscatedCodeGenerator) round(i int, v uint64) uint64 {
+	var buf [9]byte
+	buf[0] = byte(i)
+	binary.BigEndian.PutUint64(buf[1:], v)
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(buf[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+func encodeBase62(n uint64, width int) string {
+	var buf [11]byte
+	i := len(buf)
+	for n > 0 || i == len(buf) {
+		i--
+		buf[i] = base62Alphabet[n%62]
+		n /= 62
+	}
+	code := string(buf[i:])
+	if len(code) < width {
+		code = strings.Repeat("0", width-len(code)) + code
+	}
+	return code
+}
+
+func decodeBase62(code string) (uint64, error) {
+	var n uint64
+	for _, c := range code {
+		idx := strings.IndexRune(base62Alphabet, c)
+		if idx < 0 {
+			return 0, fmt.Errorf("invalid base62 character %q", c)
+		}
+		hi, lo := bits.Mul64(n, 62)
+		if hi != 0 {
+			return 0, fmt.Errorf("base62 value overflows")
+		}
+		n = lo + uint64(idx)
+	}
+	return n, nil
+}
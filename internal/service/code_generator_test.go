@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type counterSequence struct {
+	next  uint64
+	calls int
+}
+
+func (s *counterSequence) NextValue(ctx context.Context) (uint64, error) {
+	s.calls++
+	s.next++
+	return s.next, nil
+}
+
+func (s *counterSequence) NextValues(ctx context.Context, n int) ([]uint64, error) {
+	s.calls++
+	values := make([]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		s.next++
+		values = append(values, s.next)
+	}
+	return values, nil
+}
+
+func TestRandomCodeGenerator(t *testing.T) {
+	generator := NewRandomCodeGenerator(10)
+
+	for i := 0; i < 100; i++ {
+		code, err := generator.Generate(context.Background())
+		if err != nil {
+			t.Fatalf("Erro inesperado ao gerar código: %v", err)
+		}
+		if len(code) != 10 {
+			t.Errorf("Código deve ter 10 caracteres, obtido %d", len(code))
+		}
+		for _, c := range code {
+			if !strings.ContainsRune(base62Alphabet, c) {
+				t.Errorf("Código %s contém caractere fora de base62: %q", code, c)
+			}
+		}
+	}
+}
+
+func TestSequenceCodeGenerator(t *testing.T) {
+	generator := NewSequenceCodeGenerator(&counterSequence{next: 60})
+
+	first, _ := generator.Generate(context.Background())
+	second, _ := generator.Generate(context.Background())
+
+	if first != "z" || second != "10" {
+		t.Errorf("Códigos esperados z e 10, obtidos %s e %s", first, second)
+	}
+}
+
+func TestSequenceCodeGeneratorBatch(t *testing.T) {
+	seq := &counterSequence{next: 60}
+	generator := NewSequenceCodeGenerator(seq)
+
+	codes, err := generator.GenerateBatch(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao gerar lote: %v", err)
+	}
+	if strings.Join(codes, ",") != "z,10,11" {
+		t.Errorf("Códigos esperados z,10,11, obtidos %v", codes)
+	}
+	if seq.calls != 1 {
+		t.Errorf("Lote deveria reservar a sequência em uma única chamada, obtidas %d", seq.calls)
+	}
+}
+
+func TestObfuscatedCodeGenerator(t *testing.T) {
+	generator, err := NewObfuscatedCodeGenerator(&counterSequence{}, 6, "segredo")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar gerador: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var previous string
+	for i := uint64(1); i <= 1000; i++ {
+		code, err := generator.Generate(context.Background())
+		if err != nil {
+			t.Fatalf("Erro inesperado ao gerar código: %v", err)
+		}
+		if len(code) != 6 {
+			t.Errorf("Código deve ter 6 caracteres, obtido %s", code)
+		}
+		if seen[code] {
+			t.Fatalf("Código %s repetido", code)
+		}
+		seen[code] = true
+
+		if code == previous {
+			t.Errorf("Códigos consecutivos iguais: %s", code)
+		}
+		previous = code
+
+		decoded, err := generator.Decode(code)
+		if err != nil || decoded != i {
+			t.Errorf("Decodificação de %s deveria retornar %d, obtido %d (%v)", code, i, decoded, err)
+		}
+	}
+
+	other, _ := NewObfuscatedCodeGenerator(&counterSequence{}, 6, "outro-segredo")
+	a, _ := generator.Encode(42)
+	b, _ := other.Encode(42)
+	if a == b {
+		t.Error("Segredos diferentes deveriam gerar códigos diferentes")
+	}
+}
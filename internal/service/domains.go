@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+var (
+	ErrInvalidDomain = errors.New("domain must be a valid host name")
+	ErrUnknownDomain = errors.New("domain is not registered")
+)
+
+// domainCacheTTL bounds how long a domain added or removed on another
+// instance can take to be noticed here.
+const domainCacheTTL = 30 * time.Second
+
+var hostPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// WithDomains lets links be created on, and resolved from, the branded
+// domains in the repository besides the primary one in baseURL.
+func WithDomains(domains domain.DomainRepository) Option {
+	return func(s *URLService) {
+		s.domains = domains
+	}
+}
+
+// WithStrictDomains makes hosts that are neither the primary domain nor
+// registered serve no links, instead of the primary domain's.
+func WithStrictDomains(strict bool) Option {
+	return func(s *URLService) {
+		s.strictDomains = strict
+	}
+}
+
+// domainSet caches the registered hosts so resolving a request's Host does
+// not hit the database on every redirect.
+type domainSet struct {
+	mu         sync.Mutex
+	hosts      map[string]bool
+	loadedAt   time.Time
+	generation int
+}
+
+// normalizeHost lowercases a Host header and strips its port.
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// primaryHost is the host of baseURL, whose links have an empty Domain.
+func (s *URLService) primaryHost() string {
+	parsed, err := neturl.Parse(s.baseURL)
+	if err != nil {
+		return ""
+	}
+	return normalizeHost(parsed.Host)
+}
+
+// namespace returns the Domain value links on host are stored with: the
+// host lowercased and without port, or "" for the primary host.
+func (s *URLService) namespace(host string) string {
+	host = normalizeHost(host)
+	if host == s.primaryHost() {
+		return ""
+	}
+	return host
+}
+
+// ResolveHost maps the Host of a request to the domain its codes live in:
+// the host itself when it is registered, and "" for the primary host and
+// any other one, such as a bare IP or a health check's. With strict domains
+// those other hosts give ErrUnknownDomain instead.
+func (s *URLService) ResolveHost(ctx context.Context, host string) (string, error) {
+	host = s.namespace(host)
+	if host == "" || s.domains == nil {
+		return "", nil
+	}
+	registered, err := s.isRegistered(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("failed to load domains: %w", err)
+	}
+	if !registered {
+		if s.strictDomains {
+			return "", fmt.Errorf("%w: %s", ErrUnknownDomain, host)
+		}
+		return "", nil
+	}
+	return host, nil
+}
+
+// linkDomain validates the domain a link is created on and returns the value
+// stored in its Domain field.
+func (s *URLService) linkDomain(ctx context.Context, host string) (string, error) {
+	host = s.namespace(host)
+	if host == "" {
+		return "", nil
+	}
+	registered, err := s.isRegistered(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("failed to load domains: %w", err)
+	}
+	if !registered {
+		return "", fmt.Errorf("%w: %s", ErrUnknownDomain, host)
+	}
+	return host, nil
+}
+
+// isRegistered reports whether host is a branded domain. The list is loaded
+// without holding the lock, so a slow database does not queue every request
+// behind it; a list loaded across forgetDomains is used but not kept.
+func (s *URLService) isRegistered(ctx context.Context, host string) (bool, error) {
+	if s.domains == nil {
+		return false, nil
+	}
+
+	s.domainSet.mu.Lock()
+	hosts, generation := s.domainSet.hosts, s.domainSet.generation
+	fresh := hosts != nil && time.Since(s.domainSet.loadedAt) <= domainCacheTTL
+	s.domainSet.mu.Unlock()
+	if fresh {
+		return hosts[host], nil
+	}
+
+	domains, err := s.domains.List(ctx)
+	if err != nil {
+		return false, err
+	}
+	hosts = make(map[string]bool, len(domains))
+	for _, d := range domains {
+		hosts[d.Host] = true
+	}
+
+	s.domainSet.mu.Lock()
+	if s.domainSet.generation == generation {
+		s.domainSet.hosts = hosts
+		s.domainSet.loadedAt = time.Now()
+	}
+	s.domainSet.mu.Unlock()
+	return hosts[host], nil
+}
+
+func (s *URLService) forgetDomains() {
+	s.domainSet.mu.Lock()
+	s.domainSet.hosts = nil
+	s.domainSet.generation++
+	s.domainSet.mu.Unlock()
+}
+
+func (s *URLService) ListDomains(ctx context.Context) ([]domain.ShortDomain, error) {
+	if s.domains == nil {
+		return nil, nil
+	}
+	return s.domains.List(ctx)
+}
+
+// AddDomain registers a branded host. DNS for it must point at this
+// service; the host is then resolved from the Host header of requests.
+func (s *URLService) AddDomain(ctx context.Context, host string) (*domain.ShortDomain, error) {
+	if s.domains == nil {
+		return nil, errors.New("branded domains are not enabled")
+	}
+
+	host = normalizeHost(host)
+	if !hostPattern.MatchString(host) {
+		return nil, ErrInvalidDomain
+	}
+	if host == s.primaryHost() {
+		return nil, fmt.Errorf("%w: %s is the primary domain", domain.ErrDomainTaken, host)
+	}
+
+	shortDomain := &domain.ShortDomain{Host: host, CreatedAt: time.Now()}
+	if err := s.domains.Add(ctx, shortDomain); err != nil {
+		return nil, err
+	}
+	s.forgetDomains()
+	return shortDomain, nil
+}
+
+// RemoveDomain stops serving a branded host. Its links are kept and come
+// back if the host is added again.
+func (s *URLService) RemoveDomain(ctx context.Context, host string) error {
+	if s.domains == nil {
+		return domain.ErrNotFound
+	}
+	if err := s.domains.Remove(ctx, normalizeHost(host)); err != nil {
+		return err
+	}
+	s.forgetDomains()
+	return nil
+}
+
+// shortLink is the public URL of a link: baseURL for the primary domain, or
+// the link's own host with baseURL's scheme.
+func (s *URLService) shortLink(url *domain.URL, shortCode string) string {
+	if url.Domain == "" {
+		return fmt.Sprintf("%s/%s", s.baseURL, shortCode)
+	}
+	scheme := "https"
+	if parsed, err := neturl.Parse(s.baseURL); err == nil && parsed.Scheme != "" {
+		scheme = parsed.Scheme
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, url.Domain, shortCode)
+}
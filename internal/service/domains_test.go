@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+type mockDomains struct {
+	hosts map[string]domain.ShortDomain
+	err   error
+}
+
+func newMockDomains(hosts ...string) *mockDomains {
+	m := &mockDomains{hosts: make(map[string]domain.ShortDomain)}
+	for _, host := range hosts {
+		m.hosts[host] = domain.ShortDomain{Host: host, CreatedAt: time.Now()}
+	}
+	return m
+}
+
+func (m *mockDomains) List(ctx context.Context) ([]domain.ShortDomain, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var domains []domain.ShortDomain
+	for _, d := range m.hosts {
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+func (m *mockDomains) Add(ctx context.Context, d *domain.ShortDomain) error {
+	if _, exists := m.hosts[d.Host]; exists {
+		return domain.ErrDomainTaken
+	}
+	m.hosts[d.Host] = *d
+	return nil
+}
+
+func (m *mockDomains) Remove(ctx context.Context, host string) error {
+	if _, exists := m.hosts[host]; !exists {
+		return domain.ErrNotFound
+	}
+	delete(m.hosts, host)
+	return nil
+}
+
+func TestResolveHost(t *testing.T) {
+	domains := newMockDomains("go.marca.com")
+	service := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour, WithDomains(domains))
+	ctx := context.Background()
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"url.li", ""},
+		{"URL.LI:443", ""},
+		{"go.marca.com", "go.marca.com"},
+		{"Go.Marca.com:8080", "go.marca.com"},
+		{"go.marca.com.", "go.marca.com"},
+	}
+
+	for _, tt := range tests {
+		if got, err := service.ResolveHost(ctx, tt.host); err != nil || got != tt.want {
+			t.Errorf("ResolveHost(%q) = %q, %v; esperado %q", tt.host, got, err, tt.want)
+		}
+	}
+
+	// Hosts that are not registered serve the primary domain's links,
+	// unless domains are strict.
+	strict := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour, WithDomains(domains), WithStrictDomains(true))
+	for _, host := range []string{"desconhecido.com", "127.0.0.1:8080"} {
+		if got, err := service.ResolveHost(ctx, host); err != nil || got != "" {
+			t.Errorf("ResolveHost(%q) = %q, %v; esperado o domínio principal", host, got, err)
+		}
+		if _, err := strict.ResolveHost(ctx, host); !errors.Is(err, ErrUnknownDomain) {
+			t.Errorf("ResolveHost(%q) estrito: esperado ErrUnknownDomain, obtido %v", host, err)
+		}
+	}
+
+	service.forgetDomains()
+	domains.err = errors.New("banco indisponível")
+	if _, err := service.ResolveHost(ctx, "go.marca.com"); err == nil || errors.Is(err, ErrUnknownDomain) {
+		t.Errorf("Falha ao carregar domínios deveria ser um erro próprio, obtido %v", err)
+	}
+	if got, err := service.ResolveHost(ctx, "url.li"); err != nil || got != "" {
+		t.Errorf("Domínio principal não depende da lista, obtido %q, %v", got, err)
+	}
+
+	plain := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour)
+	if got, err := plain.ResolveHost(ctx, "127.0.0.1:8080"); err != nil || got != "" {
+		t.Errorf("Sem domínios de marca todo host é o principal, obtido %q, %v", got, err)
+	}
+}
+
+func TestShortenURLOnDomains(t *testing.T) {
+	service := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour, WithDomains(newMockDomains("go.marca.com")))
+	ctx := context.Background()
+
+	principal, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{Alias: "promo"})
+	if err != nil {
+		t.Fatalf("Erro inesperado no domínio principal: %v", err)
+	}
+	if principal.ShortURL != "https://url.li/promo" {
+		t.Errorf("URL curta esperada https://url.li/promo, obtida %s", principal.ShortURL)
+	}
+
+	marca, err := service.ShortenURL(ctx, "https://marca.example.com", domain.ShortenOptions{Domain: "GO.MARCA.COM", Alias: "promo"})
+	if err != nil {
+		t.Fatalf("O mesmo código deveria estar livre em outro domínio: %v", err)
+	}
+	if marca.ShortURL != "https://go.marca.com/promo" {
+		t.Errorf("URL curta esperada https://go.marca.com/promo, obtida %s", marca.ShortURL)
+	}
+
+	if _, err := service.ShortenURL(ctx, "https://outro.example.com", domain.ShortenOptions{Domain: "go.marca.com", Alias: "promo"}); !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("Esperado ErrAliasTaken no mesmo domínio, obtido %v", err)
+	}
+	if _, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{Domain: "desconhecido.com"}); !errors.Is(err, ErrUnknownDomain) {
+		t.Errorf("Esperado ErrUnknownDomain, obtido %v", err)
+	}
+
+	for host, want := range map[string]string{"url.li": "https://www.example.com", "go.marca.com": "https://marca.example.com"} {
+		redirect, err := service.ResolveRedirect(ctx, host, "promo", domain.Visit{})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao resolver %s: %v", host, err)
+		}
+		if redirect.Location != want {
+			t.Errorf("%s: destino esperado %s, obtido %s", host, want, redirect.Location)
+		}
+	}
+
+	if err := service.DeleteURL(ctx, "go.marca.com", "promo"); err != nil {
+		t.Fatalf("Erro inesperado ao excluir: %v", err)
+	}
+	if _, err := service.GetURLInfo(ctx, "url.li", "promo"); err != nil {
+		t.Errorf("Excluir no domínio da marca não deveria afetar o principal: %v", err)
+	}
+}
+
+func TestManageDomains(t *testing.T) {
+	service := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour, WithDomains(newMockDomains()), WithStrictDomains(true))
+	ctx := context.Background()
+
+	if _, err := service.AddDomain(ctx, "localhost"); !errors.Is(err, ErrInvalidDomain) {
+		t.Errorf("Esperado ErrInvalidDomain, obtido %v", err)
+	}
+	if _, err := service.AddDomain(ctx, "url.li"); !errors.Is(err, domain.ErrDomainTaken) {
+		t.Errorf("Esperado ErrDomainTaken para o domínio principal, obtido %v", err)
+	}
+
+	if _, err := service.ResolveHost(ctx, "go.marca.com"); !errors.Is(err, ErrUnknownDomain) {
+		t.Fatalf("Domínio ainda não registrado: esperado ErrUnknownDomain, obtido %v", err)
+	}
+	if _, err := service.AddDomain(ctx, "Go.Marca.com"); err != nil {
+		t.Fatalf("Erro inesperado ao adicionar domínio: %v", err)
+	}
+	if got, _ := service.ResolveHost(ctx, "go.marca.com"); got != "go.marca.com" {
+		t.Errorf("Domínio adicionado deveria ser resolvido imediatamente, obtido %q", got)
+	}
+
+	if err := service.RemoveDomain(ctx, "go.marca.com"); err != nil {
+		t.Fatalf("Erro inesperado ao remover domínio: %v", err)
+	}
+	if _, err := service.ResolveHost(ctx, "go.marca.com"); !errors.Is(err, ErrUnknownDomain) {
+		t.Errorf("Domínio removido: esperado ErrUnknownDomain, obtido %v", err)
+	}
+	if err := service.RemoveDomain(ctx, "go.marca.com"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Esperado ErrNotFound, obtido %v", err)
+	}
+}
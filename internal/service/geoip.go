@@ -0,0 +1,60 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoLocator resolves the ISO 3166-1 country code of a client IP, returning
+// an empty string when the address is unknown.
+type GeoLocator interface {
+	Country(ip string) (string, error)
+}
+
+// WithGeoLocator enables the countries condition of targeting rules. Without
+// a locator rules that name countries never match.
+func WithGeoLocator(locator GeoLocator) Option {
+	return func(s *URLService) {
+		s.geo = locator
+	}
+}
+
+// MaxMindLocator looks countries up in a local MaxMind-format (.mmdb)
+// database such as GeoLite2-Country, so no request leaves the process.
+type MaxMindLocator struct {
+	reader *maxminddb.Reader
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+func NewMaxMindLocator(path string) (*MaxMindLocator, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	return &MaxMindLocator{reader: reader}, nil
+}
+
+func (l *MaxMindLocator) Country(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", nil
+	}
+
+	var record countryRecord
+	if err := l.reader.Lookup(parsed, &record); err != nil {
+		return "", fmt.Errorf("failed to look up %s: %w", ip, err)
+	}
+	return strings.ToUpper(record.Country.ISOCode), nil
+}
+
+func (l *MaxMindLocator) Close() error {
+	return l.reader.Close()
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+// testGeoIP is a country database mapping 200.160.0.0/16 to "br" and
+// 81.84.0.0/16 to "PT". See testdata/README.md.
+const testGeoIP = "testdata/countries.mmdb"
+
+func TestMaxMindLocator(t *testing.T) {
+	locator, err := NewMaxMindLocator(testGeoIP)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao abrir base GeoIP: %v", err)
+	}
+	defer locator.Close()
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"200.160.2.3", "BR"},
+		{"81.84.10.1", "PT"},
+		{"8.8.8.8", ""},
+		{"não é um IP", ""},
+	}
+
+	for _, tt := range tests {
+		country, err := locator.Country(tt.ip)
+		if err != nil {
+			t.Errorf("Erro inesperado ao localizar %s: %v", tt.ip, err)
+		}
+		if country != tt.want {
+			t.Errorf("Country(%q) = %q; esperado %q", tt.ip, country, tt.want)
+		}
+	}
+}
+
+func TestResolveRedirectWithCountries(t *testing.T) {
+	locator, err := NewMaxMindLocator(testGeoIP)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao abrir base GeoIP: %v", err)
+	}
+	defer locator.Close()
+
+	service := NewURLService(newMockRepository(), "http://url.li", 24*time.Hour, WithGeoLocator(locator))
+	ctx := context.Background()
+
+	_, err = service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{
+		Alias: "loja",
+		Rules: []domain.TargetingRule{{Countries: "br, pt", Destination: "https://www.example.com.br"}},
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{"País correspondente", "200.160.2.3", "https://www.example.com.br"},
+		{"Outro país", "8.8.8.8", "https://www.example.com"},
+		{"Sem IP", "", "https://www.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(ctx, "", "loja", domain.Visit{ClientIP: tt.ip})
+			if err != nil {
+				t.Fatalf("Erro inesperado: %v", err)
+			}
+			if redirect.Location != tt.want {
+				t.Errorf("Destino esperado %s, obtido %s", tt.want, redirect.Location)
+			}
+		})
+	}
+}
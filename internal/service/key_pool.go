@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+	"github.com/kakuzops/ml-url/internal/metrics"
+)
+
+var ErrKeyPoolEmpty = errors.New("key pool has no keys available")
+
+type KeyPoolConfig struct {
+	// Owner identifies this server process in lease records.
+	Owner string
+	// LeaseSize is how many keys are leased into memory at once.
+	LeaseSize int
+	// LowWatermark triggers a background lease when the local pool drops below it.
+	LowWatermark int
+	LeaseTTL     time.Duration
+	// RefillInterval is how often leases are renewed, consumed keys flushed,
+	// expired leases reclaimed and the shared pool topped up.
+	RefillInterval time.Duration
+	// MinAvailable is the number of unleased keys kept in the shared pool;
+	// GenerateBatch keys are generated whenever it falls below that.
+	MinAvailable  int64
+	GenerateBatch int
+}
+
+// KeyPool is a CodeGenerator that hands out pre-generated keys leased from
+// the database, so shortening never waits on a uniqueness check.
+type KeyPool struct {
+	store     domain.KeyPoolRepository
+	generator CodeGenerator
+	cfg       KeyPoolConfig
+
+	mu       sync.Mutex
+	keys     []string
+	consumed []string
+
+	refill chan struct{}
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+func NewKeyPool(store domain.KeyPoolRepository, generator CodeGenerator, cfg KeyPoolConfig) *KeyPool {
+	return &KeyPool{
+		store:     store,
+		generator: generator,
+		cfg:       cfg,
+		refill:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+func (p *KeyPool) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	// The first fill runs in the background so startup does not wait on
+	// generating keys; Generate leases on demand until it completes.
+	go func() {
+		defer close(p.done)
+		p.maintain(ctx)
+		ticker := time.NewTicker(p.cfg.RefillInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.maintain(ctx)
+			case <-p.refill:
+				p.leaseKeys(ctx)
+			}
+		}
+	}()
+}
+
+// Close stops background maintenance and hands unused keys back to the shared pool.
+func (p *KeyPool) Close(ctx context.Context) error {
+	if p.cancel != nil {
+		p.cancel()
+		<-p.done
+	}
+
+	p.flushConsumed(ctx)
+
+	p.mu.Lock()
+	p.keys = nil
+	p.mu.Unlock()
+	metrics.SetKeyPoolLocalDepth(0)
+
+	return p.store.Release(ctx, p.cfg.Owner)
+}
+
+func (p *KeyPool) Generate(ctx context.Context) (string, error) {
+	code, ok := p.next()
+	if ok {
+		return code, nil
+	}
+
+	p.leaseKeys(ctx)
+
+	code, ok = p.next()
+	if !ok {
+		return "", ErrKeyPoolEmpty
+	}
+	return code, nil
+}
+
+func (p *KeyPool) next() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.keys) == 0 {
+		return "", false
+	}
+
+	code := p.keys[len(p.keys)-1]
+	p.keys = p.keys[:len(p.keys)-1]
+	p.consumed = append(p.consumed, code)
+	metrics.SetKeyPoolLocalDepth(len(p.keys))
+
+	if len(p.keys) < p.cfg.LowWatermark {
+		select {
+		case p.refill <- struct{}{}:
+		default:
+		}
+	}
+
+	return code, true
+}
+
+func (p *KeyPool) maintain(ctx context.Context) {
+	p.flushConsumed(ctx)
+
+	if err := p.store.Renew(ctx, p.cfg.Owner, p.cfg.LeaseTTL); err != nil {
+		log.Printf("Failed to renew key pool lease: %v", err)
+	}
+
+	if reclaimed, err := p.store.ReclaimExpired(ctx); err != nil {
+		log.Printf("Failed to reclaim expired key pool leases: %v", err)
+	} else if reclaimed > 0 {
+		log.Printf("Reclaimed %d keys from expired leases", reclaimed)
+	}
+
+	p.replenish(ctx)
+	p.leaseKeys(ctx)
+}
+
+func (p *KeyPool) leaseKeys(ctx context.Context) {
+	p.mu.Lock()
+	depth := len(p.keys)
+	p.mu.Unlock()
+
+	if depth >= p.cfg.LowWatermark {
+		return
+	}
+
+	codes, err := p.store.Lease(ctx, p.cfg.Owner, p.cfg.LeaseSize, p.cfg.LeaseTTL)
+	if err != nil {
+		log.Printf("Failed to lease keys: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	p.keys = append(p.keys, codes...)
+	metrics.SetKeyPoolLocalDepth(len(p.keys))
+	p.mu.Unlock()
+}
+
+func (p *KeyPool) flushConsumed(ctx context.Context) {
+	p.mu.Lock()
+	consumed := p.consumed
+	p.consumed = nil
+	p.mu.Unlock()
+
+	if len(consumed) == 0 {
+		return
+	}
+
+	if err := p.store.Consume(ctx, consumed); err != nil {
+		log.Printf("Failed to flush consumed keys: %v", err)
+		p.mu.Lock()
+		p.consumed = append(p.consumed, consumed...)
+		p.mu.Unlock()
+	}
+}
+
+func (p *KeyPool) replenish(ctx context.Context) {
+	available, err := p.store.CountAvailable(ctx)
+	if err != nil {
+		log.Printf("Failed to count available keys: %v", err)
+		return
+	}
+	metrics.SetKeyPoolAvailable(available)
+
+	if available >= p.cfg.MinAvailable {
+		return
+	}
+
+	codes, err := p.generateKeys(ctx)
+	if err != nil {
+		log.Printf("Failed to generate pool keys: %v", err)
+		return
+	}
+
+	inserted, err := p.store.Insert(ctx, codes)
+	if err != nil {
+		log.Printf("Failed to insert pool keys: %v", err)
+		return
+	}
+	metrics.SetKeyPoolAvailable(available + inserted)
+}
+
+func (p *KeyPool) generateKeys(ctx context.Context) ([]string, error) {
+	if batch, ok := p.generator.(BatchCodeGenerator); ok {
+		return batch.GenerateBatch(ctx, p.cfg.GenerateBatch)
+	}
+
+	codes := make([]string, 0, p.cfg.GenerateBatch)
+	for len(codes) < p.cfg.GenerateBatch {
+		code, err := p.generator.Generate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryKeyStore struct {
+	mu       sync.Mutex
+	leasedBy map[string]string
+}
+
+func newMemoryKeyStore() *memoryKeyStore {
+	return &memoryKeyStore{leasedBy: make(map[string]string)}
+}
+
+func (s *memoryKeyStore) Insert(ctx context.Context, codes []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var inserted int64
+	for _, code := range codes {
+		if _, exists := s.leasedBy[code]; !exists {
+			s.leasedBy[code] = ""
+			inserted++
+		}
+	}
+	return inserted, nil
+}
+
+func (s *memoryKeyStore) Lease(ctx context.Context, owner string, count int, ttl time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var codes []string
+	for code, leasedBy := range s.leasedBy {
+		if len(codes) == count {
+			break
+		}
+		if leasedBy == "" {
+			s.leasedBy[code] = owner
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+func (s *memoryKeyStore) Renew(ctx context.Context, owner string, ttl time.Duration) error {
+	return nil
+}
+
+func (s *memoryKeyStore) Consume(ctx context.Context, codes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, code := range codes {
+		delete(s.leasedBy, code)
+	}
+	return nil
+}
+
+func (s *memoryKeyStore) Release(ctx context.Context, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for code, leasedBy := range s.leasedBy {
+		if leasedBy == owner {
+			s.leasedBy[code] = ""
+		}
+	}
+	return nil
+}
+
+func (s *memoryKeyStore) ReclaimExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *memoryKeyStore) CountAvailable(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var available int64
+	for _, leasedBy := range s.leasedBy {
+		if leasedBy == "" {
+			available++
+		}
+	}
+	return available, nil
+}
+
+func (s *memoryKeyStore) counts() (available, leased int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, leasedBy := range s.leasedBy {
+		if leasedBy == "" {
+			available++
+		} else {
+			leased++
+		}
+	}
+	return available, leased
+}
+
+type sequentialGenerator struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (g *sequentialGenerator) Generate(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+	return fmt.Sprintf("key%05d", g.next), nil
+}
+
+func TestKeyPool(t *testing.T) {
+	store := newMemoryKeyStore()
+	pool := NewKeyPool(store, &sequentialGenerator{}, KeyPoolConfig{
+		Owner:          "pod-1",
+		LeaseSize:      10,
+		LowWatermark:   3,
+		LeaseTTL:       time.Minute,
+		RefillInterval: time.Hour,
+		MinAvailable:   50,
+		GenerateBatch:  100,
+	})
+	pool.Start(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	available, leased := store.counts()
+	for (available != 90 || leased != 10) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		available, leased = store.counts()
+	}
+	if available != 90 || leased != 10 {
+		t.Fatalf("Esperado 90 chaves disponíveis e 10 reservadas, obtido %d e %d", available, leased)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 25; i++ {
+		code, err := pool.Generate(context.Background())
+		if err != nil {
+			t.Fatalf("Erro inesperado ao obter chave: %v", err)
+		}
+		if seen[code] {
+			t.Fatalf("Chave %s entregue duas vezes", code)
+		}
+		seen[code] = true
+	}
+
+	if err := pool.Close(context.Background()); err != nil {
+		t.Fatalf("Erro inesperado ao fechar pool: %v", err)
+	}
+
+	available, leased = store.counts()
+	if leased != 0 {
+		t.Errorf("Chaves não usadas deveriam ser devolvidas ao pool, %d ainda reservadas", leased)
+	}
+	if available != 75 {
+		t.Errorf("Esperado 75 chaves disponíveis após consumo de 25, obtido %d", available)
+	}
+}
+
+func TestKeyPoolEmpty(t *testing.T) {
+	pool := NewKeyPool(newMemoryKeyStore(), &sequentialGenerator{}, KeyPoolConfig{
+		Owner:        "pod-1",
+		LeaseSize:    10,
+		LowWatermark: 3,
+	})
+
+	if _, err := pool.Generate(context.Background()); err != ErrKeyPoolEmpty {
+		t.Errorf("Esperado ErrKeyPoolEmpty, obtido %v", err)
+	}
+}
+
+func TestKeyPoolGeneratesInBatch(t *testing.T) {
+	store := newMemoryKeyStore()
+	seq := &counterSequence{}
+	pool := NewKeyPool(store, NewSequenceCodeGenerator(seq), KeyPoolConfig{
+		Owner:         "pod-1",
+		LeaseSize:     10,
+		LowWatermark:  3,
+		MinAvailable:  50,
+		GenerateBatch: 100,
+	})
+
+	pool.replenish(context.Background())
+
+	if available, _ := store.counts(); available != 100 {
+		t.Errorf("Esperado 100 chaves disponíveis, obtido %d", available)
+	}
+	if seq.calls != 1 {
+		t.Errorf("Lote deveria reservar a sequência em uma única chamada, obtidas %d", seq.calls)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	neturl "net/url"
+	"path"
+	"strings"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+var ErrInvalidQueryMerge = errors.New("query_merge must be one of keep, override or append")
+
+func validateQueryMerge(policy string) error {
+	switch policy {
+	case domain.QueryMergeNone, domain.QueryMergeKeep, domain.QueryMergeOverride, domain.QueryMergeAppend:
+		return nil
+	default:
+		return ErrInvalidQueryMerge
+	}
+}
+
+// checkPath rejects visits carrying a path after the code unless the link
+// forwards paths, so /abc/anything is not silently treated as /abc.
+func checkPath(url *domain.URL, visit domain.Visit) error {
+	if visit.Path != "" && !url.PathPassthrough {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// passThrough carries the visitor's trailing path and query string over to
+// destination as the link asks for. Destinations that cannot be parsed are
+// returned unchanged.
+func passThrough(destination string, url *domain.URL, visit domain.Visit) string {
+	forwardPath := url.PathPassthrough && visit.Path != ""
+	forwardQuery := url.QueryMerge != domain.QueryMergeNone && visit.Query != ""
+	if !forwardPath && !forwardQuery {
+		return destination
+	}
+
+	target, err := neturl.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	if forwardPath {
+		// Cleaning against the root keeps ".." from climbing above the
+		// destination's own path.
+		extra := path.Clean("/" + visit.Path)
+		if strings.HasSuffix(visit.Path, "/") && extra != "/" {
+			extra += "/"
+		}
+		// Joining the escaped forms keeps the destination's own encoding,
+		// such as an escaped slash, which Path alone cannot tell apart.
+		escaped := strings.TrimSuffix(target.EscapedPath(), "/") + (&neturl.URL{Path: extra}).EscapedPath()
+		unescaped, err := neturl.PathUnescape(escaped)
+		if err != nil {
+			return destination
+		}
+		target.Path, target.RawPath = unescaped, escaped
+	}
+
+	if forwardQuery {
+		target.RawQuery = mergeQuery(target.RawQuery, visit.Query, url.QueryMerge)
+	}
+
+	return target.String()
+}
+
+// mergeQuery adds the visitor's parameters to the destination's raw query as
+// policy says. The destination's own parameters keep their order and
+// encoding; only those the visitor overrides are dropped.
+func mergeQuery(rawQuery, incoming, policy string) string {
+	visitor, _ := neturl.ParseQuery(incoming)
+	existing, _ := neturl.ParseQuery(rawQuery)
+
+	added := neturl.Values{}
+	for key, list := range visitor {
+		if policy == domain.QueryMergeKeep && existing.Has(key) {
+			continue
+		}
+		added[key] = list
+	}
+	if len(added) == 0 {
+		return rawQuery
+	}
+
+	if policy == domain.QueryMergeOverride {
+		var kept []string
+		for _, param := range strings.Split(rawQuery, "&") {
+			key, _, _ := strings.Cut(param, "=")
+			if unescaped, err := neturl.QueryUnescape(key); err == nil {
+				key = unescaped
+			}
+			if param != "" && !added.Has(key) {
+				kept = append(kept, param)
+			}
+		}
+		rawQuery = strings.Join(kept, "&")
+	}
+
+	if rawQuery == "" {
+		return added.Encode()
+	}
+	return rawQuery + "&" + added.Encode()
+}
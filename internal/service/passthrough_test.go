@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+func TestPassThrough(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		url         domain.URL
+		visit       domain.Visit
+		want        string
+	}{
+		{
+			"Sem repasse",
+			"https://docs.example.com/v2",
+			domain.URL{},
+			domain.Visit{Path: "guia", Query: "utm_source=x"},
+			"https://docs.example.com/v2",
+		},
+		{
+			"Caminho",
+			"https://docs.example.com/v2/",
+			domain.URL{PathPassthrough: true},
+			domain.Visit{Path: "api/urls"},
+			"https://docs.example.com/v2/api/urls",
+		},
+		{
+			"Caminho com barra final",
+			"https://docs.example.com/v2",
+			domain.URL{PathPassthrough: true},
+			domain.Visit{Path: "guia/"},
+			"https://docs.example.com/v2/guia/",
+		},
+		{
+			"Caminho não sobe acima do destino",
+			"https://docs.example.com/v2",
+			domain.URL{PathPassthrough: true},
+			domain.Visit{Path: "../../admin"},
+			"https://docs.example.com/v2/admin",
+		},
+		{
+			"Codificação do destino preservada",
+			"https://docs.example.com/arquivos/a%2Fb/",
+			domain.URL{PathPassthrough: true},
+			domain.Visit{Path: "relatório final"},
+			"https://docs.example.com/arquivos/a%2Fb/relat%C3%B3rio%20final",
+		},
+		{
+			"Destino prevalece",
+			"https://www.example.com/promo?utm_source=site#topo",
+			domain.URL{QueryMerge: domain.QueryMergeKeep},
+			domain.Visit{Query: "utm_source=x&ref=abc"},
+			"https://www.example.com/promo?utm_source=site&ref=abc#topo",
+		},
+		{
+			"Visitante prevalece",
+			"https://www.example.com/promo?utm_source=site",
+			domain.URL{QueryMerge: domain.QueryMergeOverride},
+			domain.Visit{Query: "utm_source=x"},
+			"https://www.example.com/promo?utm_source=x",
+		},
+		{
+			"Ambos mantidos",
+			"https://www.example.com/promo?tag=a",
+			domain.URL{QueryMerge: domain.QueryMergeAppend},
+			domain.Visit{Query: "tag=b"},
+			"https://www.example.com/promo?tag=a&tag=b",
+		},
+		{
+			"Query do destino preservada",
+			"https://www.example.com/busca?z=1&next=%2Fconta&flag",
+			domain.URL{QueryMerge: domain.QueryMergeOverride},
+			domain.Visit{Query: "z=2&ref=abc"},
+			"https://www.example.com/busca?next=%2Fconta&flag&ref=abc&z=2",
+		},
+		{
+			"Caminho e query",
+			"https://docs.example.com",
+			domain.URL{PathPassthrough: true, QueryMerge: domain.QueryMergeKeep},
+			domain.Visit{Path: "busca", Query: "q=redis"},
+			"https://docs.example.com/busca?q=redis",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := passThrough(tt.destination, &tt.url, tt.visit); got != tt.want {
+				t.Errorf("Destino esperado %s, obtido %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveRedirectWithPath(t *testing.T) {
+	service := NewURLService(newMockRepository(), "http://url.li", 24*time.Hour)
+	ctx := context.Background()
+
+	if _, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{Alias: "fixo"}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	if _, err := service.ShortenURL(ctx, "https://docs.example.com", domain.ShortenOptions{Alias: "docs", PathPassthrough: true}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+
+	if _, err := service.ResolveRedirect(ctx, "", "fixo", domain.Visit{Path: "extra"}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Esperado ErrNotFound para caminho extra sem repasse, obtido %v", err)
+	}
+
+	redirect, err := service.ResolveRedirect(ctx, "", "docs", domain.Visit{Path: "guia/inicio"})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if redirect.Location != "https://docs.example.com/guia/inicio" {
+		t.Errorf("Destino esperado https://docs.example.com/guia/inicio, obtido %s", redirect.Location)
+	}
+	if redirect.Destination != "https://docs.example.com" {
+		t.Errorf("Destino base esperado https://docs.example.com, obtido %s", redirect.Destination)
+	}
+
+	if _, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{QueryMerge: "merge"}); !errors.Is(err, ErrInvalidQueryMerge) {
+		t.Errorf("Esperado ErrInvalidQueryMerge, obtido %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordTooLong  = errors.New("password must be at most 72 bytes")
+	ErrPasswordRequired = errors.New("link is password protected")
+	ErrWrongPassword    = errors.New("incorrect password")
+	ErrTooManyAttempts  = errors.New("too many incorrect passwords")
+)
+
+// maxPasswordLength is the longest input bcrypt hashes without truncating.
+const maxPasswordLength = 72
+
+// WithPasswordThrottle locks a protected link after repeated wrong passwords.
+func WithPasswordThrottle(limiter domain.AttemptLimiter) Option {
+	return func(s *URLService) {
+		s.passwordLimiter = limiter
+	}
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// UnlockRedirect checks the password for a protected link and, when it
+// matches, resolves the redirect like ResolveRedirect does for public links.
+// Each guess is counted before the password is compared, so parallel wrong
+// guesses cannot get past the limit.
+func (s *URLService) UnlockRedirect(ctx context.Context, host, shortCode, password string, visit domain.Visit) (*domain.Redirect, error) {
+	url, err := s.findLive(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPath(url, visit); err != nil {
+		return nil, err
+	}
+
+	if url.IsProtected() {
+		attemptKey := domain.LinkKey(url.Domain, shortCode)
+		if s.passwordLimiter != nil {
+			wait, err := s.passwordLimiter.Attempt(ctx, attemptKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record password attempt: %w", err)
+			}
+			if wait > 0 {
+				return nil, fmt.Errorf("%w: try again in %s", ErrTooManyAttempts, wait.Round(time.Second))
+			}
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(url.PasswordHash), []byte(password)); err != nil {
+			return nil, ErrWrongPassword
+		}
+		if s.passwordLimiter != nil {
+			if err := s.passwordLimiter.Reset(ctx, attemptKey); err != nil {
+				log.Printf("Failed to reset password attempts for %s: %v", shortCode, err)
+			}
+		}
+	}
+
+	return s.redirectTo(ctx, shortCode, url, visit)
+}
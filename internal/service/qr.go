@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+var ErrInvalidQR = errors.New("invalid QR code options")
+
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+
+	minQRSize     = 64
+	maxQRSize     = 2048
+	defaultQRSize = 256
+	maxQRMargin   = 16
+	// defaultQRMargin is the quiet zone the QR specification asks for.
+	defaultQRMargin = 4
+)
+
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// QROptions control how a QR code is drawn. Zero values take the defaults:
+// a 256px PNG with medium error correction and a 4 module margin.
+type QROptions struct {
+	Format string
+	// Size is the width and height of the image in pixels.
+	Size int
+	// Level is the error correction level: L, M, Q or H.
+	Level string
+	// Margin is the quiet zone around the code, in modules.
+	Margin *int
+}
+
+// Normalize fills in defaults and validates the options.
+func (o QROptions) Normalize() (QROptions, error) {
+	if o.Format == "" {
+		o.Format = QRFormatPNG
+	}
+	o.Format = strings.ToLower(o.Format)
+	if o.Format != QRFormatPNG && o.Format != QRFormatSVG {
+		return o, fmt.Errorf("%w: format must be png or svg", ErrInvalidQR)
+	}
+
+	if o.Size == 0 {
+		o.Size = defaultQRSize
+	}
+	if o.Size < minQRSize || o.Size > maxQRSize {
+		return o, fmt.Errorf("%w: size must be between %d and %d", ErrInvalidQR, minQRSize, maxQRSize)
+	}
+
+	if o.Level == "" {
+		o.Level = "M"
+	}
+	o.Level = strings.ToUpper(o.Level)
+	if _, ok := qrLevels[o.Level]; !ok {
+		return o, fmt.Errorf("%w: level must be L, M, Q or H", ErrInvalidQR)
+	}
+
+	margin := defaultQRMargin
+	if o.Margin != nil {
+		margin = *o.Margin
+	}
+	if margin < 0 || margin > maxQRMargin {
+		return o, fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidQR, maxQRMargin)
+	}
+	o.Margin = &margin
+
+	return o, nil
+}
+
+// RenderQR draws content as a QR code. PNG output is exactly Size pixels
+// wide, with modules scaled to whole pixels and any remainder added to the
+// margin; SVG output scales freely and is Size wide by default.
+func RenderQR(content string, opts QROptions) ([]byte, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, qrLevels[opts.Level])
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	if opts.Format == QRFormatSVG {
+		return renderQRSVG(modules, opts.Size, *opts.Margin), nil
+	}
+	return renderQRPNG(modules, opts.Size, *opts.Margin)
+}
+
+func renderQRPNG(modules [][]bool, size, margin int) ([]byte, error) {
+	total := len(modules) + 2*margin
+	scale := size / total
+	if scale < 1 {
+		return nil, fmt.Errorf("%w: size %d is too small for this code, use at least %d", ErrInvalidQR, size, total)
+	}
+	offset := (size - scale*total) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			left, top := offset+(margin+x)*scale, offset+(margin+y)*scale
+			for py := top; py < top+scale; py++ {
+				for px := left; px < left+scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderQRSVG draws one unit per module, so the code stays sharp at any
+// size it is printed at.
+func renderQRSVG(modules [][]bool, size, margin int) []byte {
+	total := len(modules) + 2*margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, total, total)
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", margin+x, margin+y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRenderQRPNG(t *testing.T) {
+	margin := 2
+	data, err := RenderQR("http://url.li/Ab3Cd4Ef", QROptions{Size: 300, Level: "h", Margin: &margin})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao gerar QR: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("PNG inválido: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 300 || bounds.Dy() != 300 {
+		t.Fatalf("Tamanho esperado 300x300, obtido %dx%d", bounds.Dx(), bounds.Dy())
+	}
+
+	dark := func(x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r == 0
+	}
+	if dark(0, 0) || dark(299, 299) {
+		t.Error("Margem deveria ser branca")
+	}
+
+	// The finder pattern's outer ring starts right after the margin, in the
+	// top-left corner. Find it on the diagonal and check it is square.
+	start := -1
+	for i := 0; i < 150; i++ {
+		if dark(i, i) {
+			start = i
+			break
+		}
+	}
+	if start <= 0 {
+		t.Fatal("Padrão de posição não encontrado")
+	}
+	if !dark(start, start+10) || !dark(start+10, start) {
+		t.Error("Padrão de posição deveria começar no mesmo ponto nos dois eixos")
+	}
+}
+
+func TestRenderQRSVG(t *testing.T) {
+	data, err := RenderQR("http://url.li/Ab3Cd4Ef", QROptions{Format: "SVG", Size: 512})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao gerar QR: %v", err)
+	}
+
+	svg := string(data)
+	if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>") {
+		t.Errorf("SVG inválido: %s", svg)
+	}
+	if !strings.Contains(svg, `width="512" height="512"`) {
+		t.Errorf("SVG deveria ter 512px, obtido %s", svg[:120])
+	}
+	// A 25-module version 2 code with the default 4 module margin.
+	if !strings.Contains(svg, `viewBox="0 0 33 33"`) {
+		t.Errorf("viewBox inesperado: %s", svg[:120])
+	}
+	if !strings.Contains(svg, "M4 4h1v1h-1z") {
+		t.Error("Primeiro módulo do padrão de posição deveria estar após a margem")
+	}
+}
+
+func TestRenderQRInvalidOptions(t *testing.T) {
+	negative, large := -1, 17
+	tests := []struct {
+		name    string
+		content string
+		opts    QROptions
+	}{
+		{"Formato desconhecido", "http://url.li/Ab3Cd4Ef", QROptions{Format: "gif"}},
+		{"Tamanho pequeno", "http://url.li/Ab3Cd4Ef", QROptions{Size: 10}},
+		{"Tamanho grande", "http://url.li/Ab3Cd4Ef", QROptions{Size: 5000}},
+		{"Nível desconhecido", "http://url.li/Ab3Cd4Ef", QROptions{Level: "X"}},
+		{"Margem negativa", "http://url.li/Ab3Cd4Ef", QROptions{Margin: &negative}},
+		{"Margem grande", "http://url.li/Ab3Cd4Ef", QROptions{Margin: &large}},
+		{"Tamanho insuficiente para o código", strings.Repeat("a", 500), QROptions{Size: 64}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := RenderQR(tt.content, tt.opts); !errors.Is(err, ErrInvalidQR) {
+				t.Errorf("Esperado ErrInvalidQR, obtido %v", err)
+			}
+		})
+	}
+}
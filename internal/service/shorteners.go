@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+// maxShortenerHops bounds how many shortener redirects a destination is
+// followed through before it is rejected.
+const maxShortenerHops = 10
+
+// DefaultShortenerHosts are the public URL shorteners recognised when no
+// list is configured.
+var DefaultShortenerHosts = []string{
+	"bit.ly",
+	"bitly.com",
+	"buff.ly",
+	"cutt.ly",
+	"goo.gl",
+	"is.gd",
+	"lnkd.in",
+	"ow.ly",
+	"rb.gy",
+	"rebrand.ly",
+	"s.id",
+	"shorturl.at",
+	"t.co",
+	"t.ly",
+	"tiny.cc",
+	"tinyurl.com",
+	"v.gd",
+}
+
+// ShortenerResolver recognises links of other URL shorteners among
+// destinations, which would hide where a short link really leads. With an
+// HTTP client they are followed to the URL they redirect to; without one
+// they are rejected. Only hosts on the list are ever requested.
+type ShortenerResolver struct {
+	hosts   map[string]bool
+	client  *http.Client
+	timeout time.Duration
+}
+
+// NewShortenerResolver recognises hosts, or DefaultShortenerHosts when hosts
+// is empty, and their subdomains. A nil client rejects their links instead
+// of resolving them. A positive timeout bounds following a whole chain of
+// redirects, however many hops it takes.
+func NewShortenerResolver(hosts []string, client *http.Client, timeout time.Duration) *ShortenerResolver {
+	if len(hosts) == 0 {
+		hosts = DefaultShortenerHosts
+	}
+	r := &ShortenerResolver{hosts: make(map[string]bool, len(hosts)), timeout: timeout}
+	for _, host := range hosts {
+		r.hosts[asciiHost(strings.TrimSpace(host))] = true
+	}
+	if client != nil {
+		// Redirects are followed one at a time so every hop is checked.
+		hop := *client
+		hop.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		r.client = &hop
+	}
+	return r
+}
+
+// WithShortenerResolver makes destinations on other shorteners resolve, or
+// be rejected, as the resolver says.
+func WithShortenerResolver(resolver *ShortenerResolver) Option {
+	return func(s *URLService) {
+		s.shorteners = resolver
+	}
+}
+
+func (r *ShortenerResolver) isShortener(host string) bool {
+	for candidate := host; ; {
+		if r.hosts[candidate] {
+			return true
+		}
+		_, parent, found := strings.Cut(candidate, ".")
+		if !found {
+			return false
+		}
+		candidate = parent
+	}
+}
+
+// next returns the URL a shortener link redirects to. It asks with GET, as
+// some shorteners do not answer HEAD with the redirect.
+func (r *ShortenerResolver) next(ctx context.Context, link *neturl.URL) (*neturl.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		return nil, fmt.Errorf("answered %d instead of a redirect", resp.StatusCode)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return nil, err
+	}
+	if location.Scheme != "http" && location.Scheme != "https" {
+		return nil, fmt.Errorf("redirects to a %s URL", location.Scheme)
+	}
+	return location, nil
+}
+
+// ownsHost reports whether host serves this service's short links.
+func (s *URLService) ownsHost(ctx context.Context, host string) (bool, error) {
+	host = asciiHost(host)
+	if host == s.primaryHost() {
+		return true, nil
+	}
+	return s.isRegistered(ctx, host)
+}
+
+// resolveChain returns the URL a destination really leads to, following it
+// through other shorteners, within the resolver's timeout, when they are
+// resolved. Destinations on this
+// service's own domains, directly or at the end of a chain, are rejected:
+// they would make links that redirect to each other.
+func (s *URLService) resolveChain(ctx context.Context, destination string) (string, error) {
+	current, err := neturl.Parse(destination)
+	if err != nil || current.Hostname() == "" {
+		return destination, nil
+	}
+
+	if s.shorteners != nil && s.shorteners.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.shorteners.timeout)
+		defer cancel()
+	}
+
+	seen := make(map[string]bool)
+	for hops := 0; ; hops++ {
+		host := asciiHost(current.Hostname())
+		own, err := s.ownsHost(ctx, host)
+		if err != nil {
+			return "", fmt.Errorf("failed to load domains: %w", err)
+		}
+		if own {
+			detail := fmt.Sprintf("%s is a link of this shortener", destination)
+			if hops > 0 {
+				detail = fmt.Sprintf("%s redirects back to this shortener", destination)
+			}
+			return "", &RejectionError{Reason: RejectLoop, Detail: detail}
+		}
+
+		if s.shorteners == nil || !s.shorteners.isShortener(host) {
+			if hops == 0 {
+				return destination, nil
+			}
+			return current.String(), nil
+		}
+		if s.shorteners.client == nil {
+			return "", &RejectionError{Reason: RejectShortener, Detail: fmt.Sprintf("%s is a link of another shortener", destination)}
+		}
+		if seen[current.String()] {
+			return "", &RejectionError{Reason: RejectLoop, Detail: fmt.Sprintf("%s redirects in a loop", destination)}
+		}
+		if hops == maxShortenerHops {
+			return "", &RejectionError{Reason: RejectShortener, Detail: fmt.Sprintf("%s redirects through too many shorteners", destination)}
+		}
+		seen[current.String()] = true
+
+		next, err := s.shorteners.next(ctx, current)
+		if err != nil {
+			return "", &RejectionError{Reason: RejectShortener, Detail: fmt.Sprintf("%s could not be resolved: %v", current, err)}
+		}
+		current = next
+	}
+}
+
+// resolveDestinations resolves the long URL of a link and, in place, the
+// destinations of its rules and variants.
+func (s *URLService) resolveDestinations(ctx context.Context, longURL string, rules []domain.TargetingRule, variants []domain.Variant) (string, error) {
+	var err error
+	if longURL != "" {
+		if longURL, err = s.resolveChain(ctx, longURL); err != nil {
+			return "", err
+		}
+	}
+	for i := range rules {
+		if rules[i].Destination, err = s.resolveChain(ctx, rules[i].Destination); err != nil {
+			return "", err
+		}
+	}
+	for i := range variants {
+		if variants[i].Destination, err = s.resolveChain(ctx, variants[i].Destination); err != nil {
+			return "", err
+		}
+	}
+	return longURL, nil
+}
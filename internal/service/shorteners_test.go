@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+// newFakeShorteners serves the redirects in routes, keyed by host and path.
+// The returned client sends requests for any host to it and counts them.
+func newFakeShorteners(t *testing.T, routes map[string]string) (*http.Client, *atomic.Int32) {
+	t.Helper()
+	requests := new(atomic.Int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		location, ok := routes[r.Host+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+	return client, requests
+}
+
+func rejectedWith(err error, reason RejectionReason) bool {
+	var rejection *RejectionError
+	return errors.As(err, &rejection) && rejection.Reason == reason
+}
+
+func TestShortenURLRejectsOwnLinks(t *testing.T) {
+	service := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour, WithDomains(newMockDomains("go.marca.com")))
+	ctx := context.Background()
+
+	for _, longURL := range []string{"https://url.li/abc", "URL.LI/abc", "http://url.li:8080/", "https://go.marca.com/promo"} {
+		_, err := service.ShortenURL(ctx, longURL, domain.ShortenOptions{})
+		if !rejectedWith(err, RejectLoop) {
+			t.Errorf("%s: esperado motivo %q, obtido %v", longURL, RejectLoop, err)
+		}
+		if !errors.Is(err, ErrURLRejected) {
+			t.Errorf("%s: esperado ErrURLRejected, obtido %v", longURL, err)
+		}
+	}
+
+	_, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{
+		Variants: []domain.Variant{
+			{Name: "a", Destination: "https://www.example.com/a", Weight: 50},
+			{Name: "b", Destination: "https://url.li/b", Weight: 50},
+		},
+	})
+	if !rejectedWith(err, RejectLoop) {
+		t.Errorf("Variante para o próprio domínio deveria ser rejeitada, obtido %v", err)
+	}
+
+	if _, err := service.ShortenURL(ctx, "https://url.li.example.com/", domain.ShortenOptions{}); err != nil {
+		t.Errorf("Erro inesperado para outro domínio: %v", err)
+	}
+}
+
+func TestShortenURLRejectsShorteners(t *testing.T) {
+	service := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour,
+		WithShortenerResolver(NewShortenerResolver(nil, nil, 0)))
+	ctx := context.Background()
+
+	for _, longURL := range []string{"https://bit.ly/3xYz", "tinyurl.com/abc", "https://www.bit.ly/3xYz"} {
+		if _, err := service.ShortenURL(ctx, longURL, domain.ShortenOptions{}); !rejectedWith(err, RejectShortener) {
+			t.Errorf("%s: esperado motivo %q, obtido %v", longURL, RejectShortener, err)
+		}
+	}
+
+	if _, err := service.ShortenURL(ctx, "https://notbit.ly/abc", domain.ShortenOptions{}); err != nil {
+		t.Errorf("Erro inesperado para domínio que não é encurtador: %v", err)
+	}
+}
+
+func TestShortenURLResolvesShorteners(t *testing.T) {
+	client, requests := newFakeShorteners(t, map[string]string{
+		"sho.rt/a":        "http://outro.link/b",
+		"outro.link/b":    "https://www.example.com/final?x=1",
+		"sho.rt/volta":    "https://url.li/abc",
+		"sho.rt/loop":     "http://outro.link/loop",
+		"outro.link/loop": "http://sho.rt/loop",
+		"sho.rt/js":       "javascript:alert(1)",
+	})
+	resolver := NewShortenerResolver([]string{"sho.rt", "outro.link"}, client, 0)
+	service := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour, WithShortenerResolver(resolver))
+	ctx := context.Background()
+
+	url, err := service.ShortenURL(ctx, "http://sho.rt/a", domain.ShortenOptions{Alias: "resolvido"})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	if url.LongURL != "https://www.example.com/final?x=1" {
+		t.Errorf("Destino final esperado https://www.example.com/final?x=1, obtido %s", url.LongURL)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("Esperadas 2 requisições aos encurtadores, obtidas %d", got)
+	}
+
+	tests := []struct {
+		longURL string
+		reason  RejectionReason
+	}{
+		{"http://sho.rt/volta", RejectLoop},
+		{"http://sho.rt/loop", RejectLoop},
+		{"http://sho.rt/inexistente", RejectShortener},
+		{"http://sho.rt/js", RejectShortener},
+	}
+	for _, tt := range tests {
+		if _, err := service.ShortenURL(ctx, tt.longURL, domain.ShortenOptions{}); !rejectedWith(err, tt.reason) {
+			t.Errorf("%s: esperado motivo %q, obtido %v", tt.longURL, tt.reason, err)
+		}
+	}
+
+	requests.Store(0)
+	if _, err := service.ShortenURL(ctx, "https://www.example.com/sem-encurtador", domain.ShortenOptions{}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	if got := requests.Load(); got != 0 {
+		t.Errorf("Destinos comuns não deveriam ser requisitados, obtidas %d requisições", got)
+	}
+
+	updated, err := service.UpdateURL(ctx, "", "resolvido", domain.UpdateOptions{
+		Variants: &[]domain.Variant{
+			{Name: "a", Destination: "http://sho.rt/a", Weight: 50},
+			{Name: "b", Destination: "https://www.example.com/b", Weight: 50},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao atualizar URL: %v", err)
+	}
+	if updated.Variants[0].Destination != "https://www.example.com/final?x=1" {
+		t.Errorf("Variante deveria apontar para o destino final, obtido %s", updated.Variants[0].Destination)
+	}
+
+	loop := "http://sho.rt/volta"
+	if _, err := service.UpdateURL(ctx, "", "resolvido", domain.UpdateOptions{LongURL: &loop}); !rejectedWith(err, RejectLoop) {
+		t.Errorf("Esperado motivo %q ao atualizar, obtido %v", RejectLoop, err)
+	}
+}
+
+func TestUpdateURLKeepsUnchangedDestinations(t *testing.T) {
+	repo := newMockRepository()
+	ctx := context.Background()
+
+	// Links saved before shorteners were rejected keep their destination.
+	legacy := NewURLService(repo, "https://url.li", 24*time.Hour)
+	if _, err := legacy.ShortenURL(ctx, "https://bit.ly/antigo", domain.ShortenOptions{
+		Alias:    "antigo",
+		Variants: []domain.Variant{{Name: "a", Destination: "https://bit.ly/a", Weight: 100}},
+	}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+
+	service := NewURLService(repo, "https://url.li", 24*time.Hour, WithShortenerResolver(NewShortenerResolver(nil, nil, 0)))
+	longURL, title := "https://bit.ly/antigo", "Novo título"
+	variants := []domain.Variant{{Name: "a", Destination: "https://bit.ly/a", Weight: 100}}
+	url, err := service.UpdateURL(ctx, "", "antigo", domain.UpdateOptions{LongURL: &longURL, Variants: &variants, Title: &title})
+	if err != nil {
+		t.Fatalf("Destinos inalterados não deveriam ser verificados de novo: %v", err)
+	}
+	if url.Title != title {
+		t.Errorf("Título esperado %q, obtido %q", title, url.Title)
+	}
+
+	changed := "https://bit.ly/outro"
+	if _, err := service.UpdateURL(ctx, "", "antigo", domain.UpdateOptions{LongURL: &changed}); !rejectedWith(err, RejectShortener) {
+		t.Errorf("Destino alterado deveria ser verificado, obtido %v", err)
+	}
+}
+
+func TestResolveShortenersWithinTimeout(t *testing.T) {
+	// Each hop answers well within the timeout, but the chain does not.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(40 * time.Millisecond)
+		if r.URL.Path == "/1111" {
+			http.Redirect(w, r, "https://www.example.com/final", http.StatusFound)
+			return
+		}
+		next := r.URL.Path[1:] + "1"
+		http.Redirect(w, r, "http://sho.rt/"+next, http.StatusFound)
+	}))
+	t.Cleanup(server.Close)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+
+	slow := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour,
+		WithShortenerResolver(NewShortenerResolver([]string{"sho.rt"}, client, 100*time.Millisecond)))
+	start := time.Now()
+	if _, err := slow.ShortenURL(context.Background(), "http://sho.rt/", domain.ShortenOptions{}); !rejectedWith(err, RejectShortener) {
+		t.Errorf("Esperado motivo %q ao estourar o tempo, obtido %v", RejectShortener, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Resolução deveria parar no tempo limite, levou %v", elapsed)
+	}
+
+	patient := NewURLService(newMockRepository(), "https://url.li", 24*time.Hour,
+		WithShortenerResolver(NewShortenerResolver([]string{"sho.rt"}, client, 5*time.Second)))
+	url, err := patient.ShortenURL(context.Background(), "http://sho.rt/", domain.ShortenOptions{})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao resolver: %v", err)
+	}
+	if url.LongURL != "https://www.example.com/final" {
+		t.Errorf("Destino final esperado https://www.example.com/final, obtido %s", url.LongURL)
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	neturl "net/url"
+	"strings"
+)
+
+var ErrInvalidImageURL = errors.New("image_url must be an absolute http or https URL of at most 2048 characters")
+
+const maxImageURLLength = 2048
+
+// unfurlers are User-Agent fragments of the bots chat apps and social
+// networks send to build a card for a pasted link. Search engine crawlers
+// are left out on purpose: they should see the redirect.
+var unfurlers = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"slackbot",
+	"linkedinbot",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"skypeuripreview",
+	"microsoftpreview",
+	"pinterest",
+	"redditbot",
+	"mastodon",
+	"embedly",
+	"iframely",
+	"vkshare",
+	"viber",
+}
+
+// IsUnfurler reports whether a User-Agent belongs to a bot building a link
+// preview card rather than a visitor following the link.
+func IsUnfurler(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, fragment := range unfurlers {
+		if strings.Contains(ua, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateImageURL(imageURL string) error {
+	if imageURL == "" {
+		return nil
+	}
+	if len(imageURL) > maxImageURLLength {
+		return ErrInvalidImageURL
+	}
+	parsed, err := neturl.Parse(imageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrInvalidImageURL
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+func TestIsUnfurler(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      bool
+	}{
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", true},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", true},
+		{"WhatsApp/2.23.20.0", true},
+		{"TelegramBot (like TwitterBot)", true},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148", false},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsUnfurler(tt.userAgent); got != tt.want {
+			t.Errorf("IsUnfurler(%q) = %v; esperado %v", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestImageURLValidation(t *testing.T) {
+	service := NewURLService(newMockRepository(), "http://url.li", 24*time.Hour)
+	ctx := context.Background()
+
+	for _, imageURL := range []string{"javascript:alert(1)", "/card.png", "ftp://cdn.example.com/card.png", "https://"} {
+		_, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{ImageURL: imageURL})
+		if !errors.Is(err, ErrInvalidImageURL) {
+			t.Errorf("%s: esperado ErrInvalidImageURL, obtido %v", imageURL, err)
+		}
+	}
+
+	url, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{Alias: "cartao", ImageURL: "https://cdn.example.com/card.png"})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	if url.ImageURL != "https://cdn.example.com/card.png" {
+		t.Errorf("Imagem esperada https://cdn.example.com/card.png, obtida %s", url.ImageURL)
+	}
+
+	invalid, empty := "data:image/png;base64,AAAA", ""
+	if _, err := service.UpdateURL(ctx, "", "cartao", domain.UpdateOptions{ImageURL: &invalid}); !errors.Is(err, ErrInvalidImageURL) {
+		t.Errorf("Esperado ErrInvalidImageURL ao atualizar, obtido %v", err)
+	}
+	updated, err := service.UpdateURL(ctx, "", "cartao", domain.UpdateOptions{ImageURL: &empty})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao remover imagem: %v", err)
+	}
+	if updated.ImageURL != "" {
+		t.Errorf("Imagem deveria ter sido removida, obtida %s", updated.ImageURL)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -14,8 +16,13 @@ type URLStats struct {
 	LongURL     string    `json:"long_url"`
 	AccessCount int64     `json:"access_count"`
 	LastAccess  time.Time `json:"last_access"`
+	// Variants counts redirects per A/B variant of the link.
+	Variants map[string]int64 `json:"variants,omitempty"`
 }
 
+// variantField prefixes the per-variant counters kept in a link's stats hash.
+const variantField = "variant:"
+
 type StatsService struct {
 	redis *redis.Client
 }
@@ -26,11 +33,16 @@ func NewStatsService(redis *redis.Client) *StatsService {
 	}
 }
 
-func (s *StatsService) IncrementAccess(shortURL, longURL string) error {
+// IncrementAccess counts a redirect to longURL, and towards variant when the
+// visitor was sent to one of the link's A/B variants.
+func (s *StatsService) IncrementAccess(shortURL, longURL, variant string) error {
 	ctx := context.Background()
 	key := fmt.Sprintf("stats:url:%s", shortURL)
 	pipe := s.redis.Pipeline()
 	pipe.HIncrBy(ctx, key, "access_count", 1)
+	if variant != "" {
+		pipe.HIncrBy(ctx, key, variantField+variant, 1)
+	}
 	pipe.HSet(ctx, key, "last_access", time.Now().Format(time.RFC3339))
 	pipe.HSet(ctx, key, "long_url", longURL)
 	pipe.Expire(ctx, key, 30*24*time.Hour)
@@ -38,6 +50,49 @@ func (s *StatsService) IncrementAccess(shortURL, longURL string) error {
 	return err
 }
 
+// Clicks returns how many redirects have counted towards a link's click
+// limit.
+func (s *StatsService) Clicks(ctx context.Context, shortURL string) (int64, error) {
+	count, err := s.redis.Get(ctx, fmt.Sprintf("clicks:url:%s", shortURL)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return count, err
+}
+
+// IncrementClicks atomically counts a redirect towards a link's click limit
+// and returns the new total. The counter lives next to the stats hash but
+// outside it, so it is not lost when idle stats expire; a positive ttl makes
+// it expire with the link, set in the same transaction as the first count.
+func (s *StatsService) IncrementClicks(ctx context.Context, shortURL string, ttl time.Duration) (int64, error) {
+	key := fmt.Sprintf("clicks:url:%s", shortURL)
+	pipe := s.redis.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	if ttl > 0 {
+		pipe.ExpireNX(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count click: %w", err)
+	}
+	return count.Val(), nil
+}
+
+// ExpireClicks moves a link's click counter to a new expiry, or keeps it
+// for good when ttl is zero.
+func (s *StatsService) ExpireClicks(ctx context.Context, shortURL string, ttl time.Duration) error {
+	key := fmt.Sprintf("clicks:url:%s", shortURL)
+	if ttl > 0 {
+		return s.redis.Expire(ctx, key, ttl).Err()
+	}
+	return s.redis.Persist(ctx, key).Err()
+}
+
+// ResetLinkCounters forgets a link's click count and stats, variant counters
+// included, so a reissued code starts from zero.
+func (s *StatsService) ResetLinkCounters(ctx context.Context, shortURL string) error {
+	return s.redis.Del(ctx, fmt.Sprintf("clicks:url:%s", shortURL), fmt.Sprintf("stats:url:%s", shortURL)).Err()
+}
+
 func (s *StatsService) GetTopURLs(limit int) ([]URLStats, error) {
 	ctx := context.Background()
 
@@ -93,10 +148,23 @@ func (s *StatsService) GetURLStats(shortURL string) (*URLStats, error) {
 	count, _ := s.redis.HGet(ctx, key, "access_count").Int64()
 	lastAccess, _ := time.Parse(time.RFC3339, data["last_access"])
 
+	var variants map[string]int64
+	for field, value := range data {
+		name, ok := strings.CutPrefix(field, variantField)
+		if !ok {
+			continue
+		}
+		if variants == nil {
+			variants = make(map[string]int64)
+		}
+		variants[name], _ = strconv.ParseInt(value, 10, 64)
+	}
+
 	return &URLStats{
 		ShortURL:    shortURL,
 		LongURL:     data["long_url"],
 		AccessCount: count,
 		LastAccess:  lastAccess,
+		Variants:    variants,
 	}, nil
 }
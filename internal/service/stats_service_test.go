@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/kakuzops/ml-url/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestStatsService(t *testing.T) (*StatsService, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	return NewStatsService(redis.NewClient(&redis.Options{Addr: server.Addr()})), server
+}
+
+func TestResetLinkCounters(t *testing.T) {
+	stats, server := newTestStatsService(t)
+	ctx := context.Background()
+
+	if err := stats.IncrementAccess("abc", "https://www.example.com", "B"); err != nil {
+		t.Fatalf("Erro inesperado ao contar acesso: %v", err)
+	}
+	if _, err := stats.IncrementClicks(ctx, "abc", 0); err != nil {
+		t.Fatalf("Erro inesperado ao contar clique: %v", err)
+	}
+
+	if err := stats.ResetLinkCounters(ctx, "abc"); err != nil {
+		t.Fatalf("Erro inesperado ao zerar contadores: %v", err)
+	}
+	for _, key := range []string{"clicks:url:abc", "stats:url:abc"} {
+		if server.Exists(key) {
+			t.Errorf("Chave %s deveria ter sido removida", key)
+		}
+	}
+	if _, err := stats.GetURLStats("abc"); err == nil {
+		t.Error("Código reemitido não deveria herdar estatísticas")
+	}
+}
+
+func TestIncrementClicks(t *testing.T) {
+	stats, server := newTestStatsService(t)
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		count, err := stats.IncrementClicks(ctx, "abc", time.Hour)
+		if err != nil {
+			t.Fatalf("Erro inesperado ao contar clique: %v", err)
+		}
+		if count != want {
+			t.Errorf("Contagem esperada %d, obtida %d", want, count)
+		}
+		server.FastForward(time.Minute)
+	}
+	if count, err := stats.Clicks(ctx, "abc"); err != nil || count != 3 {
+		t.Errorf("Contagem lida esperada 3, obtida %d (%v)", count, err)
+	}
+	if count, err := stats.Clicks(ctx, "novo"); err != nil || count != 0 {
+		t.Errorf("Link sem cliques deveria ter contagem 0, obtida %d (%v)", count, err)
+	}
+	if ttl := server.TTL("clicks:url:abc"); ttl != 57*time.Minute {
+		t.Errorf("Contador deveria expirar com o link (57m restantes), TTL obtido %v", ttl)
+	}
+
+	// A counter left without a TTL gets one on the next click.
+	server.Set("clicks:url:xyz", "4")
+	if count, _ := stats.IncrementClicks(ctx, "xyz", time.Hour); count != 5 {
+		t.Errorf("Contagem esperada 5, obtida %d", count)
+	}
+	if ttl := server.TTL("clicks:url:xyz"); ttl != time.Hour {
+		t.Errorf("Contador sem expiração deveria receber uma, TTL obtido %v", ttl)
+	}
+
+	if _, err := stats.IncrementClicks(ctx, "permanente", 0); err != nil {
+		t.Fatalf("Erro inesperado ao contar clique: %v", err)
+	}
+	if ttl := server.TTL("clicks:url:permanente"); ttl != 0 {
+		t.Errorf("Link permanente não deveria ter contador com expiração, TTL obtido %v", ttl)
+	}
+}
+
+func TestClickLimitFollowsExtendedExpiry(t *testing.T) {
+	stats, server := newTestStatsService(t)
+	service := NewURLService(newMockRepository(), "http://url.li", 24*time.Hour, WithClickCounter(stats))
+	ctx := context.Background()
+
+	if _, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{Alias: "limitado", MaxClicks: 2, TTL: time.Hour}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	if _, err := service.ResolveRedirect(ctx, "", "limitado", domain.Visit{}); err != nil {
+		t.Fatalf("Erro inesperado ao recuperar URL: %v", err)
+	}
+
+	if _, err := service.UpdateURL(ctx, "", "limitado", domain.UpdateOptions{TTL: 3 * time.Hour}); err != nil {
+		t.Fatalf("Erro inesperado ao estender URL: %v", err)
+	}
+	if ttl := server.TTL("clicks:url:limitado"); ttl < 2*time.Hour {
+		t.Errorf("Contador deveria expirar com o link estendido, TTL obtido %v", ttl)
+	}
+
+	server.FastForward(2 * time.Hour)
+	if _, err := service.ResolveRedirect(ctx, "", "limitado", domain.Visit{}); err != nil {
+		t.Fatalf("Erro inesperado ao recuperar URL: %v", err)
+	}
+	if _, err := service.ResolveRedirect(ctx, "", "limitado", domain.Visit{}); !errors.Is(err, domain.ErrExhausted) {
+		t.Errorf("Limite não deveria ser zerado após estender a URL, obtido %v", err)
+	}
+
+	if _, err := service.UpdateURL(ctx, "", "limitado", domain.UpdateOptions{NeverExpires: true}); err != nil {
+		t.Fatalf("Erro inesperado ao remover expiração: %v", err)
+	}
+	if ttl := server.TTL("clicks:url:limitado"); ttl != 0 {
+		t.Errorf("Contador de link permanente não deveria expirar, TTL obtido %v", ttl)
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+var ErrInvalidRule = errors.New("invalid targeting rule")
+
+const maxTargetingRules = 20
+
+const timeOfDayLayout = "15:04"
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// locations caches the time zones rules were validated with, so matching a
+// rule does not read the zone database on every redirect.
+var locations sync.Map
+
+var (
+	targetOSes    = map[string]bool{"ios": true, "android": true, "windows": true, "macos": true, "linux": true}
+	targetDevices = map[string]bool{"mobile": true, "tablet": true, "desktop": true, "bot": true}
+)
+
+// normalizeRules validates targeting rules and returns them in canonical
+// form, numbered in evaluation order.
+func normalizeRules(rules []domain.TargetingRule) ([]domain.TargetingRule, error) {
+	if len(rules) > maxTargetingRules {
+		return nil, fmt.Errorf("%w: a link may have at most %d rules", ErrInvalidRule, maxTargetingRules)
+	}
+
+	normalized := make([]domain.TargetingRule, 0, len(rules))
+	for i, rule := range rules {
+		rule.OS = strings.ToLower(strings.TrimSpace(rule.OS))
+		if rule.OS != "" && !targetOSes[rule.OS] {
+			return nil, fmt.Errorf("%w: rule %d: unknown os %q", ErrInvalidRule, i+1, rule.OS)
+		}
+
+		rule.Device = strings.ToLower(strings.TrimSpace(rule.Device))
+		if rule.Device != "" && !targetDevices[rule.Device] {
+			return nil, fmt.Errorf("%w: rule %d: unknown device %q", ErrInvalidRule, i+1, rule.Device)
+		}
+
+		var languages []string
+		for _, language := range strings.Split(rule.Languages, ",") {
+			if language = strings.ToLower(strings.TrimSpace(language)); language != "" {
+				languages = append(languages, language)
+			}
+		}
+		rule.Languages = strings.Join(languages, ",")
+
+		var countries []string
+		for _, country := range strings.Split(rule.Countries, ",") {
+			if country = strings.ToUpper(strings.TrimSpace(country)); country == "" {
+				continue
+			}
+			if !countryCodePattern.MatchString(country) {
+				return nil, fmt.Errorf("%w: rule %d: country %q must be a two-letter ISO code", ErrInvalidRule, i+1, country)
+			}
+			countries = append(countries, country)
+		}
+		rule.Countries = strings.Join(countries, ",")
+
+		if (rule.TimeFrom == "") != (rule.TimeTo == "") {
+			return nil, fmt.Errorf("%w: rule %d: time_from and time_to must be set together", ErrInvalidRule, i+1)
+		}
+		for _, value := range []string{rule.TimeFrom, rule.TimeTo} {
+			if _, err := time.Parse(timeOfDayLayout, value); value != "" && err != nil {
+				return nil, fmt.Errorf("%w: rule %d: time %q must be HH:MM", ErrInvalidRule, i+1, value)
+			}
+		}
+		if rule.TimeFrom != "" && minuteOfDay(rule.TimeFrom) == minuteOfDay(rule.TimeTo) {
+			return nil, fmt.Errorf("%w: rule %d: time_from and time_to must differ", ErrInvalidRule, i+1)
+		}
+		if rule.Timezone != "" {
+			if _, err := loadLocation(rule.Timezone); err != nil {
+				return nil, fmt.Errorf("%w: rule %d: unknown timezone %q", ErrInvalidRule, i+1, rule.Timezone)
+			}
+		}
+
+		destination := strings.TrimSpace(rule.Destination)
+		if destination != "" && !hasProtocol(destination) {
+			destination = "https://" + destination
+		}
+		if parsed, err := neturl.Parse(destination); err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: rule %d: destination must be a valid URL", ErrInvalidRule, i+1)
+		}
+		rule.Destination = destination
+
+		rule.ID = 0
+		rule.URLID = ""
+		rule.Position = i
+		normalized = append(normalized, rule)
+	}
+	return normalized, nil
+}
+
+func sameRules(a, b []domain.TargetingRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		x.ID, x.URLID, y.ID, y.URLID = 0, "", 0, ""
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// destinationFor returns where a visit should be sent: the destination of
+// the first matching rule, else one of the link's variants, else its
+// LongURL. The variant's name is returned alongside when one was chosen.
+func (s *URLService) destinationFor(url *domain.URL, visit domain.Visit) (string, string) {
+	if destination, ok := s.matchRules(url.Rules, visit); ok {
+		return destination, ""
+	}
+	if variant := chooseVariant(url.Variants, visit.Variant); variant != nil {
+		return variant.Destination, variant.Name
+	}
+	return url.LongURL, ""
+}
+
+// matchRules returns the destination of the first rule matching the visit.
+// The visitor's country is only looked up once a rule asks for it.
+func (s *URLService) matchRules(rules []domain.TargetingRule, visit domain.Visit) (string, bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+
+	country, located := "", false
+	locate := func() string {
+		if !located {
+			country, located = s.country(visit.ClientIP), true
+		}
+		return country
+	}
+
+	os, device := classifyUserAgent(visit.UserAgent)
+	languages := acceptedLanguages(visit.AcceptLanguage)
+	now := visit.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	for _, rule := range rules {
+		if rule.OS != "" && rule.OS != os {
+			continue
+		}
+		if rule.Device != "" && rule.Device != device {
+			continue
+		}
+		if rule.Languages != "" && !matchLanguages(rule.Languages, languages) {
+			continue
+		}
+		if rule.TimeFrom != "" && !inTimeWindow(rule, now) {
+			continue
+		}
+		if rule.Countries != "" && !containsCode(rule.Countries, locate()) {
+			continue
+		}
+		return rule.Destination, true
+	}
+	return "", false
+}
+
+func (s *URLService) country(ip string) string {
+	if s.geo == nil || ip == "" {
+		return ""
+	}
+	country, err := s.geo.Country(ip)
+	if err != nil {
+		log.Printf("Failed to locate %s: %v", ip, err)
+		return ""
+	}
+	return country
+}
+
+func containsCode(list, code string) bool {
+	if code == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		if candidate == code {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyUserAgent returns the operating system and device class of a
+// User-Agent, or empty strings for what it cannot tell.
+func classifyUserAgent(userAgent string) (os, device string) {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		os = "ios"
+	case strings.Contains(ua, "android"):
+		os = "android"
+	case strings.Contains(ua, "windows"):
+		os = "windows"
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		os = "macos"
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		os = "linux"
+	}
+
+	switch {
+	case ua == "":
+		device = ""
+	case strings.Contains(ua, "bot"), strings.Contains(ua, "crawler"), strings.Contains(ua, "spider"):
+		device = "bot"
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"),
+		os == "android" && !strings.Contains(ua, "mobile"):
+		device = "tablet"
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		device = "mobile"
+	default:
+		device = "desktop"
+	}
+
+	return os, device
+}
+
+// acceptedLanguages lists the lowercase tags of an Accept-Language header,
+// leaving out the ones the client refused with q=0.
+func acceptedLanguages(header string) []string {
+	var languages []string
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		if q := strings.TrimSpace(params); q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+			continue
+		}
+		languages = append(languages, tag)
+	}
+	return languages
+}
+
+func matchLanguages(ruleLanguages string, accepted []string) bool {
+	for _, want := range strings.Split(ruleLanguages, ",") {
+		for _, tag := range accepted {
+			if tag == want || strings.HasPrefix(tag, want+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inTimeWindow reports whether now falls in the rule's time window. A rule
+// whose time zone cannot be loaded never matches.
+func inTimeWindow(rule domain.TargetingRule, now time.Time) bool {
+	location := time.UTC
+	if rule.Timezone != "" {
+		loaded, err := loadLocation(rule.Timezone)
+		if err != nil {
+			log.Printf("Failed to load timezone %q for targeting rule: %v", rule.Timezone, err)
+			return false
+		}
+		location = loaded
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	from := minuteOfDay(rule.TimeFrom)
+	to := minuteOfDay(rule.TimeTo)
+
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if cached, ok := locations.Load(name); ok {
+		return cached.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+func minuteOfDay(value string) int {
+	parsed, err := time.Parse(timeOfDayLayout, value)
+	if err != nil {
+		return 0
+	}
+	return parsed.Hour()*60 + parsed.Minute()
+}
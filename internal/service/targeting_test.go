@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	iPadUA    = "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36"
+	tabletUA  = "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	macUA     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"
+	windowsUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	botUA     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		os        string
+		device    string
+	}{
+		{iPhoneUA, "ios", "mobile"},
+		{iPadUA, "ios", "tablet"},
+		{androidUA, "android", "mobile"},
+		{tabletUA, "android", "tablet"},
+		{macUA, "macos", "desktop"},
+		{windowsUA, "windows", "desktop"},
+		{botUA, "", "bot"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		os, device := classifyUserAgent(tt.userAgent)
+		if os != tt.os || device != tt.device {
+			t.Errorf("classifyUserAgent(%q) = %s, %s; esperado %s, %s", tt.userAgent, os, device, tt.os, tt.device)
+		}
+	}
+}
+
+func TestDestinationFor(t *testing.T) {
+	rules, err := normalizeRules([]domain.TargetingRule{
+		{OS: "iOS", Destination: "apps.apple.com/app/id1"},
+		{OS: "android", Destination: "https://play.google.com/store/apps/details?id=app"},
+		{Languages: "pt, es-AR", Destination: "https://www.example.com/pt"},
+		{TimeFrom: "22:00", TimeTo: "06:00", Timezone: "America/Sao_Paulo", Destination: "https://www.example.com/night"},
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao validar regras: %v", err)
+	}
+	url := &domain.URL{LongURL: "https://www.example.com", Rules: rules}
+	service := NewURLService(newMockRepository(), "http://url.li", 24*time.Hour)
+
+	noon := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)  // 12:00 em São Paulo
+	night := time.Date(2024, 3, 1, 4, 30, 0, 0, time.UTC) // 01:30 em São Paulo
+	tests := []struct {
+		name  string
+		visit domain.Visit
+		want  string
+	}{
+		{"iOS", domain.Visit{UserAgent: iPhoneUA, Time: noon}, "https://apps.apple.com/app/id1"},
+		{"Android", domain.Visit{UserAgent: androidUA, Time: noon}, "https://play.google.com/store/apps/details?id=app"},
+		{"Idioma regional", domain.Visit{UserAgent: windowsUA, AcceptLanguage: "pt-BR,pt;q=0.9,en;q=0.8", Time: noon}, "https://www.example.com/pt"},
+		{"Idioma recusado", domain.Visit{UserAgent: windowsUA, AcceptLanguage: "en, pt;q=0", Time: noon}, "https://www.example.com"},
+		{"Janela que passa da meia-noite", domain.Visit{UserAgent: macUA, Time: night}, "https://www.example.com/night"},
+		{"Sem regra correspondente", domain.Visit{UserAgent: macUA, Time: noon}, "https://www.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := service.destinationFor(url, tt.visit); got != tt.want {
+				t.Errorf("Destino esperado %s, obtido %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInTimeWindow(t *testing.T) {
+	if _, err := normalizeRules([]domain.TargetingRule{
+		{TimeFrom: "09:00", TimeTo: "18:00", Timezone: "Asia/Tokyo", Destination: "https://www.example.com"},
+	}); err != nil {
+		t.Fatalf("Erro inesperado ao validar regras: %v", err)
+	}
+	if _, ok := locations.Load("Asia/Tokyo"); !ok {
+		t.Error("Fuso validado deveria ficar em cache para os redirects")
+	}
+
+	morning := time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC) // 10:00 em Tóquio
+	rule := domain.TargetingRule{TimeFrom: "09:00", TimeTo: "18:00", Timezone: "Asia/Tokyo"}
+	if !inTimeWindow(rule, morning) {
+		t.Error("Regra deveria valer às 10:00 em Tóquio")
+	}
+
+	// A zone that cannot be loaded must not fall back to UTC, where 10:00
+	// is inside the window.
+	rule.Timezone = "Mars/Olympus"
+	if inTimeWindow(rule, morning.Add(9*time.Hour)) {
+		t.Error("Regra com fuso desconhecido não deveria valer")
+	}
+}
+
+func TestNormalizeRulesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule domain.TargetingRule
+	}{
+		{"Sistema desconhecido", domain.TargetingRule{OS: "symbian", Destination: "https://www.example.com"}},
+		{"Dispositivo desconhecido", domain.TargetingRule{Device: "watch", Destination: "https://www.example.com"}},
+		{"País inválido", domain.TargetingRule{Countries: "Brasil", Destination: "https://www.example.com"}},
+		{"Horário incompleto", domain.TargetingRule{TimeFrom: "08:00", Destination: "https://www.example.com"}},
+		{"Horário inválido", domain.TargetingRule{TimeFrom: "8h", TimeTo: "18:00", Destination: "https://www.example.com"}},
+		{"Janela vazia", domain.TargetingRule{TimeFrom: "08:00", TimeTo: "08:00", Destination: "https://www.example.com"}},
+		{"Fuso desconhecido", domain.TargetingRule{TimeFrom: "08:00", TimeTo: "18:00", Timezone: "Mars/Olympus", Destination: "https://www.example.com"}},
+		{"Sem destino", domain.TargetingRule{OS: "ios"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := normalizeRules([]domain.TargetingRule{tt.rule}); !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("Esperado ErrInvalidRule, obtido %v", err)
+			}
+		})
+	}
+}
+
+func TestResolveRedirectWithRules(t *testing.T) {
+	repo := newMockRepository()
+	service := NewURLService(repo, "http://url.li", 24*time.Hour,
+		WithRedirectPolicy(http.StatusMovedPermanently, time.Hour),
+	)
+	ctx := context.Background()
+
+	_, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{
+		Alias: "app",
+		Rules: []domain.TargetingRule{{OS: "ios", Destination: "https://apps.apple.com/app/id1"}},
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+
+	redirect, err := service.ResolveRedirect(ctx, "", "app", domain.Visit{UserAgent: iPhoneUA})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if redirect.Location != "https://apps.apple.com/app/id1" {
+		t.Errorf("Destino esperado https://apps.apple.com/app/id1, obtido %s", redirect.Location)
+	}
+	if redirect.CacheMaxAge != 0 {
+		t.Errorf("Redirect com regras não deveria ser cacheável, obtido %s", redirect.CacheMaxAge)
+	}
+
+	empty := []domain.TargetingRule{}
+	url, err := service.UpdateURL(ctx, "", "app", domain.UpdateOptions{Rules: &empty})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao remover regras: %v", err)
+	}
+	if len(url.Rules) != 0 {
+		t.Errorf("Regras deveriam ter sido removidas, obtidas %d", len(url.Rules))
+	}
+	if audit := repo.audits[len(repo.audits)-1]; audit.Changes == "" {
+		t.Error("Remoção de regras deveria ser auditada")
+	}
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// readList returns the entries of a list file: its non-blank lines with
+// anything after a # removed.
+func readList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// listStamp identifies a version of a list file. The size is compared too,
+// as a file rewritten within the modification time's resolution keeps it.
+type listStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statList(path string) (listStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return listStamp{}, err
+	}
+	return listStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// watchList calls reload whenever the modification time or size of path
+// changes, until ctx is done. A list that fails to load keeps its previous
+// contents and is retried until it loads, so a file caught half-written is
+// picked up once it is complete.
+func watchList(ctx context.Context, path string, interval time.Duration, reload func() error) {
+	loaded, _ := statList(path)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var failed listStamp
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current, err := statList(path)
+				if err != nil || current == loaded {
+					continue
+				}
+				if err := reload(); err != nil {
+					if current != failed {
+						log.Printf("Failed to reload %s: %v", path, err)
+						failed = current
+					}
+					continue
+				}
+				loaded = current
+				log.Printf("Reloaded %s", path)
+			}
+		}
+	}()
+}
+
+// asciiHost returns the lowercase ASCII form of a host, as list entries are
+// written.
+func asciiHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := idna.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+// DomainListValidator rejects destinations by host from a file of rules,
+// one per line:
+//
+//	deny example.com       # example.com and its subdomains
+//	allow www.example.com  # except this one
+//	deny *                 # everything not allowed explicitly
+//
+// The most specific rule matching a host decides; hosts no rule matches
+// are accepted.
+type DomainListValidator struct {
+	path string
+
+	mu    sync.RWMutex
+	rules map[string]bool
+}
+
+func NewDomainListValidator(path string) (*DomainListValidator, error) {
+	v := &DomainListValidator{path: path}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload reads the list file again, keeping the current rules if it is
+// invalid.
+func (v *DomainListValidator) Reload() error {
+	entries, err := readList(v.path)
+	if err != nil {
+		return fmt.Errorf("failed to read domain list: %w", err)
+	}
+
+	rules := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		action, host, found := strings.Cut(entry, " ")
+		host = strings.TrimSpace(host)
+		if !found || host == "" || (action != "allow" && action != "deny") {
+			return fmt.Errorf("invalid domain list entry %q: want \"allow <domain>\" or \"deny <domain>\"", entry)
+		}
+		if host != "*" {
+			host = asciiHost(host)
+		}
+		rules[host] = action == "allow"
+	}
+
+	v.mu.Lock()
+	v.rules = rules
+	v.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the list whenever its file changes, until ctx is done.
+func (v *DomainListValidator) Watch(ctx context.Context, interval time.Duration) {
+	watchList(ctx, v.path, interval, v.Reload)
+}
+
+func (v *DomainListValidator) Validate(ctx context.Context, destination *neturl.URL) error {
+	host := asciiHost(destination.Hostname())
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for candidate := host; ; {
+		if allowed, ok := v.rules[candidate]; ok {
+			if allowed {
+				return nil
+			}
+			return &RejectionError{Reason: RejectDenylisted, Detail: fmt.Sprintf("host %s is blocked", host)}
+		}
+		_, parent, found := strings.Cut(candidate, ".")
+		if !found {
+			break
+		}
+		candidate = parent
+	}
+
+	if allowed, ok := v.rules["*"]; ok && !allowed {
+		return &RejectionError{Reason: RejectNotAllowed, Detail: fmt.Sprintf("host %s is not on the allow list", host)}
+	}
+	return nil
+}
+
+const (
+	minHashPrefix = 4
+	maxHashPrefix = sha256.Size
+	// Like Safe Browsing, only the last few host components and the first
+	// few path segments are combined into expressions to look up.
+	maxHostSuffixes = 5
+	maxPathPrefixes = 4
+)
+
+// HashPrefixValidator rejects destinations listed in a Safe-Browsing-style
+// file of SHA-256 hashes, one hex-encoded hash or hash prefix (4 to 32
+// bytes) per line. Each destination is looked up as the host/path
+// expressions Safe Browsing uses (evil.example.com/login, example.com/ ...),
+// and any listed prefix of their hashes rejects it.
+type HashPrefixValidator struct {
+	path string
+
+	mu sync.RWMutex
+	// prefixes holds the listed hashes by their length in bytes.
+	prefixes map[int]map[string]bool
+}
+
+func NewHashPrefixValidator(path string) (*HashPrefixValidator, error) {
+	v := &HashPrefixValidator{path: path}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload reads the list file again, keeping the current hashes if it is
+// invalid.
+func (v *HashPrefixValidator) Reload() error {
+	entries, err := readList(v.path)
+	if err != nil {
+		return fmt.Errorf("failed to read hash list: %w", err)
+	}
+
+	prefixes := make(map[int]map[string]bool)
+	for _, entry := range entries {
+		prefix, err := hex.DecodeString(entry)
+		if err != nil || len(prefix) < minHashPrefix || len(prefix) > maxHashPrefix {
+			return fmt.Errorf("invalid hash list entry %q: want %d to %d hex-encoded bytes", entry, minHashPrefix, maxHashPrefix)
+		}
+		if prefixes[len(prefix)] == nil {
+			prefixes[len(prefix)] = make(map[string]bool)
+		}
+		prefixes[len(prefix)][string(prefix)] = true
+	}
+
+	v.mu.Lock()
+	v.prefixes = prefixes
+	v.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the list whenever its file changes, until ctx is done.
+func (v *HashPrefixValidator) Watch(ctx context.Context, interval time.Duration) {
+	watchList(ctx, v.path, interval, v.Reload)
+}
+
+func (v *HashPrefixValidator) Validate(ctx context.Context, destination *neturl.URL) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, expression := range urlExpressions(destination) {
+		sum := sha256.Sum256([]byte(expression))
+		for length, listed := range v.prefixes {
+			if listed[string(sum[:length])] {
+				return &RejectionError{Reason: RejectUnsafe, Detail: fmt.Sprintf("%s is listed as unsafe", destination.Hostname())}
+			}
+		}
+	}
+	return nil
+}
+
+// unescapeAll percent-unescapes s until nothing is left to unescape. Like
+// Safe Browsing, it leaves a % that does not start an escape as it is.
+func unescapeAll(s string) string {
+	for {
+		var b strings.Builder
+		changed := false
+		for i := 0; i < len(s); i++ {
+			if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+				decoded, _ := hex.DecodeString(s[i+1 : i+3])
+				b.WriteByte(decoded[0])
+				i += 2
+				changed = true
+				continue
+			}
+			b.WriteByte(s[i])
+		}
+		if !changed {
+			return s
+		}
+		s = b.String()
+	}
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// escapeCanonical percent-escapes the bytes Safe Browsing escapes in a
+// canonical URL: controls, spaces, non-ASCII, # and %.
+func escapeCanonical(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c >= 0x7f || c == '#' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// canonicalParts returns the host, path and query of a URL canonicalized as
+// Safe Browsing does before hashing: fully unescaped, the host lowercased
+// without stray dots, and the path with repeated slashes, "." and ".."
+// resolved. Lists would otherwise miss a URL spelled differently.
+func canonicalParts(destination *neturl.URL) (string, string, string) {
+	host := unescapeAll(destination.Hostname())
+	host = strings.Trim(strings.ToLower(host), ".")
+	for strings.Contains(host, "..") {
+		host = strings.ReplaceAll(host, "..", ".")
+	}
+
+	raw := unescapeAll(destination.EscapedPath())
+	cleaned := path.Clean("/" + raw)
+	if cleaned != "/" && (strings.HasSuffix(raw, "/") || strings.HasSuffix(raw, "/.") || strings.HasSuffix(raw, "/..")) {
+		cleaned += "/"
+	}
+
+	query := unescapeAll(destination.RawQuery)
+	return escapeCanonical(asciiHost(host)), escapeCanonical(cleaned), escapeCanonical(query)
+}
+
+// urlExpressions returns the host suffix and path prefix combinations a URL
+// is looked up as, once canonicalized: for https://a.b.example.com/1/2.html?x=1
+// these range from a.b.example.com/1/2.html?x=1 down to example.com/.
+func urlExpressions(destination *neturl.URL) []string {
+	host, path, query := canonicalParts(destination)
+
+	hosts := []string{host}
+	labels := strings.Split(host, ".")
+	if len(labels) > maxHostSuffixes {
+		labels = labels[len(labels)-maxHostSuffixes:]
+	}
+	for i := 0; i < len(labels)-1; i++ {
+		if suffix := strings.Join(labels[i:], "."); suffix != host {
+			hosts = append(hosts, suffix)
+		}
+	}
+
+	var paths []string
+	if query != "" {
+		paths = append(paths, path+"?"+query)
+	}
+	paths = append(paths, path)
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	prefix := "/"
+	for i := 0; i < maxPathPrefixes; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		if i >= len(segments)-1 {
+			break
+		}
+		prefix += segments[i] + "/"
+	}
+
+	expressions := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			expressions = append(expressions, h+p)
+		}
+	}
+	return expressions
+}
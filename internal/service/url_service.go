@@ -2,106 +2,785 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/kakuzops/ml-url/internal/domain"
 	"github.com/kakuzops/ml-url/internal/metrics"
 )
 
+var (
+	ErrInvalidAlias  = errors.New("alias must be 3 to 32 characters of letters, digits, '-' or '_'")
+	ErrReservedAlias = errors.New("alias is reserved")
+	ErrAliasTaken    = errors.New("alias already in use")
+
+	ErrShortCodeExhausted = errors.New("could not allocate a unique short code")
+
+	ErrInvalidExpiration   = errors.New("invalid expiration")
+	ErrPermanentNotAllowed = errors.New("links that never expire are not allowed")
+	ErrInvalidActivation   = errors.New("invalid activation")
+
+	ErrTitleTooLong = errors.New("title must be at most 255 characters")
+
+	ErrInvalidRedirectType = errors.New("redirect_type must be one of 301, 302, 307 or 308")
+)
+
+const (
+	maxTitleLength = 255
+	anonymousActor = "anonymous"
+)
+
+const (
+	maxShortCodeAttempts = 5
+	defaultCodeLength    = 8
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+var reservedAliases = map[string]bool{
+	"health":  true,
+	"metrics": true,
+	"info":    true,
+	"stats":   true,
+	"shorten": true,
+	"links":   true,
+	"account": true,
+	"domains": true,
+	"qr":      true,
+}
+
 type URLService struct {
-	repo     domain.URLRepository
-	baseURL  string
-	duration time.Duration
+	repo      domain.URLRepository
+	baseURL   string
+	duration  time.Duration
+	generator CodeGenerator
+
+	dedupe         bool
+	dedupePerOwner bool
+
+	minTTL         time.Duration
+	maxTTL         time.Duration
+	allowPermanent bool
+
+	recorder *AccessRecorder
+
+	defaultRedirect int
+	permanentMaxAge time.Duration
+
+	passwordLimiter domain.AttemptLimiter
+	clicks          ClickCounter
+	geo             GeoLocator
+	utmTemplates    domain.UTMTemplateRepository
+
+	domains       domain.DomainRepository
+	domainSet     domainSet
+	strictDomains bool
+
+	validators []URLValidator
+	shorteners *ShortenerResolver
+}
+
+type Option func(*URLService)
+
+func WithCodeGenerator(generator CodeGenerator) Option {
+	return func(s *URLService) {
+		s.generator = generator
+	}
+}
+
+// WithDeduplication makes ShortenURL return the existing active link for an
+// equivalent long URL by default; perOwner limits matches to the same owner.
+func WithDeduplication(enabled, perOwner bool) Option {
+	return func(s *URLService) {
+		s.dedupe = enabled
+		s.dedupePerOwner = perOwner
+	}
+}
+
+// WithExpirationBounds limits the lifetime a client may request for a link.
+// A zero max means no upper bound.
+func WithExpirationBounds(minTTL, maxTTL time.Duration, allowPermanent bool) Option {
+	return func(s *URLService) {
+		s.minTTL = minTTL
+		s.maxTTL = maxTTL
+		s.allowPermanent = allowPermanent
+	}
+}
+
+// WithRedirectPolicy sets the status used for links without their own
+// redirect_type and how long permanent (301/308) redirects may be cached.
+func WithRedirectPolicy(defaultStatus int, permanentMaxAge time.Duration) Option {
+	return func(s *URLService) {
+		s.defaultRedirect = defaultStatus
+		s.permanentMaxAge = permanentMaxAge
+	}
+}
+
+// WithAccessRecorder counts redirects served by ResolveRedirect.
+func WithAccessRecorder(recorder *AccessRecorder) Option {
+	return func(s *URLService) {
+		s.recorder = recorder
+	}
 }
 
-func NewURLService(repo domain.URLRepository, baseURL string, duration time.Duration) *URLService {
-	return &URLService{
-		repo:     repo,
-		baseURL:  baseURL,
-		duration: duration,
+func NewURLService(repo domain.URLRepository, baseURL string, duration time.Duration, opts ...Option) *URLService {
+	s := &URLService{
+		repo:            repo,
+		baseURL:         baseURL,
+		duration:        duration,
+		generator:       NewRandomCodeGenerator(defaultCodeLength),
+		allowPermanent:  true,
+		defaultRedirect: http.StatusFound,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-func (s *URLService) ShortenURL(ctx context.Context, longURL string) (*domain.URL, error) {
+func (s *URLService) ShortenURL(ctx context.Context, longURL string, opts domain.ShortenOptions) (*domain.URL, error) {
 	if !hasProtocol(longURL) {
 		longURL = "https://" + longURL
 	}
 
-	shortCode, err := generateShortCode()
+	host, err := s.linkDomain(ctx, opts.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Alias != "" {
+		if err := validateAlias(opts.Alias); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateTitle(opts.Title); err != nil {
+		return nil, err
+	}
+
+	if err := validateImageURL(opts.ImageURL); err != nil {
+		return nil, err
+	}
+
+	if err := validateRedirectType(opts.RedirectType); err != nil {
+		return nil, err
+	}
+
+	if err := validateMaxClicks(opts.MaxClicks); err != nil {
+		return nil, err
+	}
+
+	if err := validateQueryMerge(opts.QueryMerge); err != nil {
+		return nil, err
+	}
+
+	utm, err := normalizeUTM(opts.UTM.WithDefaults(s.defaultUTM(ctx, opts.Owner)))
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := normalizeRules(opts.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := normalizeVariants(opts.Variants)
+	if err != nil {
+		return nil, err
+	}
+
+	longURL, err = s.resolveDestinations(ctx, longURL, rules, variants)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkDestinations(ctx, linkDestinations(longURL, rules, variants)...); err != nil {
+		return nil, err
+	}
+
+	var passwordHash string
+	if opts.Password != "" {
+		hash, err := hashPassword(opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = hash
+	}
+
+	if opts.ActivatesAt != nil && opts.ExpiresAt != nil && !opts.ExpiresAt.After(*opts.ActivatesAt) {
+		return nil, fmt.Errorf("%w: activates_at must be before expires_at", ErrInvalidActivation)
+	}
+
+	expiresAt, err := s.resolveExpiration(opts, activationStart(opts.ActivatesAt, time.Now()))
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate short code: %w", err)
+		return nil, err
+	}
+
+	longURLHash := hashURL(longURL)
+
+	dedupe := s.dedupe
+	if opts.Dedupe != nil {
+		dedupe = *opts.Dedupe
+	}
+	if dedupe && opts.Alias == "" && !opts.HasExpiration() && opts.Password == "" && opts.MaxClicks == 0 && opts.ActivatesAt == nil && len(rules) == 0 && len(variants) == 0 &&
+		opts.RedirectType == 0 && opts.Title == "" && opts.Description == "" && opts.ImageURL == "" &&
+		opts.QueryMerge == domain.QueryMergeNone && !opts.PathPassthrough && utm.IsZero() && !opts.Preview {
+		existing, err := s.findExisting(ctx, host, longURLHash, opts.Owner)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			existing.Existing = true
+			existing.ShortURL = s.shortLink(existing, existing.ShortURL)
+			return existing, nil
+		}
 	}
 
 	url := &domain.URL{
-		ShortURL:  shortCode,
-		LongURL:   longURL,
-		ExpiresAt: time.Now().Add(s.duration),
-		CreatedAt: time.Now(),
+		Domain:       host,
+		LongURL:      longURL,
+		LongURLHash:  longURLHash,
+		Owner:        opts.Owner,
+		Title:        opts.Title,
+		Description:  opts.Description,
+		ImageURL:     opts.ImageURL,
+		RedirectType: opts.RedirectType,
+		PasswordHash: passwordHash,
+		MaxClicks:    opts.MaxClicks,
+		Rules:        rules,
+		Variants:     variants,
+		ExpiresAt:    expiresAt,
+		ActivatesAt:  opts.ActivatesAt,
+		CreatedAt:    time.Now(),
+
+		QueryMerge:      opts.QueryMerge,
+		PathPassthrough: opts.PathPassthrough,
+		UTM:             utm,
+		Preview:         opts.Preview,
 	}
 
-	if err := s.repo.Save(ctx, url); err != nil {
-		return nil, fmt.Errorf("failed to save URL: %w", err)
+	if opts.Alias != "" {
+		url.ShortURL = opts.Alias
+		if err := s.repo.Create(ctx, url); err != nil {
+			if errors.Is(err, domain.ErrShortURLTaken) {
+				return nil, ErrAliasTaken
+			}
+			return nil, fmt.Errorf("failed to save URL: %w", err)
+		}
+	} else if err := s.createWithGeneratedCode(ctx, url); err != nil {
+		return nil, err
 	}
+	shortCode := url.ShortURL
 
-	url.ShortURL = fmt.Sprintf("%s/%s", s.baseURL, shortCode)
+	url.ShortURL = s.shortLink(url, shortCode)
 
 	return url, nil
 }
 
-func (s *URLService) GetLongURL(ctx context.Context, shortCode string) (string, error) {
-	url, err := s.GetURLInfo(ctx, shortCode)
+// activationStart is when a link's lifetime begins: its activation time if
+// that is still ahead, otherwise now.
+func activationStart(activatesAt *time.Time, now time.Time) time.Time {
+	if activatesAt != nil && activatesAt.After(now) {
+		return *activatesAt
+	}
+	return now
+}
+
+func (s *URLService) resolveExpiration(opts domain.ShortenOptions, now time.Time) (*time.Time, error) {
+	set := 0
+	for _, present := range []bool{opts.ExpiresAt != nil, opts.TTL != 0, opts.NeverExpires} {
+		if present {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("%w: use only one of expires_at, ttl or never_expires", ErrInvalidExpiration)
+	}
+
+	if opts.NeverExpires {
+		if !s.allowPermanent {
+			return nil, ErrPermanentNotAllowed
+		}
+		return nil, nil
+	}
+
+	ttl := s.duration
+	if opts.ExpiresAt != nil {
+		ttl = opts.ExpiresAt.Sub(now)
+	} else if opts.TTL != 0 {
+		ttl = opts.TTL
+	}
+
+	if opts.HasExpiration() {
+		if ttl <= 0 {
+			return nil, fmt.Errorf("%w: expiration must be in the future", ErrInvalidExpiration)
+		}
+		if ttl < s.minTTL {
+			return nil, fmt.Errorf("%w: links must live at least %s", ErrInvalidExpiration, s.minTTL)
+		}
+		if s.maxTTL > 0 && ttl > s.maxTTL {
+			return nil, fmt.Errorf("%w: links may live at most %s", ErrInvalidExpiration, s.maxTTL)
+		}
+	}
+
+	expiresAt := now.Add(ttl)
+	return &expiresAt, nil
+}
+
+func (s *URLService) findExisting(ctx context.Context, host, longURLHash, owner string) (*domain.URL, error) {
+	var ownerFilter *string
+	if s.dedupePerOwner {
+		ownerFilter = &owner
+	}
+
+	existing, err := s.repo.FindByLongURLHash(ctx, host, longURLHash, ownerFilter)
 	if err != nil {
-		return "", err
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up existing URL: %w", err)
 	}
-	return url.LongURL, nil
+	return existing, nil
 }
 
-func (s *URLService) GetURLInfo(ctx context.Context, shortCode string) (*domain.URL, error) {
-	url, err := s.repo.FindByShortURL(ctx, shortCode)
+func (s *URLService) createWithGeneratedCode(ctx context.Context, url *domain.URL) error {
+	for attempt := 0; attempt < maxShortCodeAttempts; attempt++ {
+		shortCode, err := s.generator.Generate(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to generate short code: %w", err)
+		}
+		if reservedAliases[strings.ToLower(shortCode)] {
+			continue
+		}
+		url.ShortURL = shortCode
+
+		err = s.repo.Create(ctx, url)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, domain.ErrShortURLTaken) {
+			return fmt.Errorf("failed to save URL: %w", err)
+		}
+		metrics.IncrementShortCodeCollisions()
+	}
+
+	metrics.IncrementShortCodeExhausted()
+	return ErrShortCodeExhausted
+}
+
+// ResolveRedirect looks up the link for a visit and decides how to redirect
+// it, applying the link's targeting rules to pick the destination. Links
+// with a preview are only followed, and counted, once the visit is
+// confirmed; until then the redirect asks for the preview page.
+func (s *URLService) ResolveRedirect(ctx context.Context, host, shortCode string, visit domain.Visit) (*domain.Redirect, error) {
+	url, err := s.findLive(ctx, host, shortCode)
 	if err != nil {
-		return nil, fmt.Errorf("URL not found: %w", err)
+		return nil, err
+	}
+
+	if err := checkPath(url, visit); err != nil {
+		return nil, err
 	}
 
-	if time.Now().After(url.ExpiresAt) {
-		return nil, fmt.Errorf("URL has expired")
+	if url.IsProtected() {
+		return nil, ErrPasswordRequired
+	}
+
+	if url.Preview && !visit.Confirmed {
+		if err := s.checkClicks(ctx, shortCode, url); err != nil {
+			return nil, err
+		}
+		destination, variant := s.destinationFor(url, visit)
+		return &domain.Redirect{
+			URL:         url,
+			Location:    passThrough(withUTM(destination, url, shortCode), url, visit),
+			Destination: destination,
+			Variant:     variant,
+			Preview:     true,
+		}, nil
+	}
+
+	return s.redirectTo(ctx, shortCode, url, visit)
+}
+
+func (s *URLService) redirectTo(ctx context.Context, shortCode string, url *domain.URL, visit domain.Visit) (*domain.Redirect, error) {
+	if err := s.claimClick(ctx, shortCode, url); err != nil {
+		return nil, err
+	}
+
+	if s.recorder != nil {
+		s.recorder.Record(url.Domain, shortCode, time.Now())
+	}
+
+	status := url.RedirectType
+	if status == 0 {
+		status = s.defaultRedirect
+	}
+
+	var maxAge time.Duration
+	if (status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect) && !url.HasClickLimit() && len(url.Rules) == 0 && len(url.Variants) == 0 && !url.Preview {
+		maxAge = s.permanentMaxAge
+		if url.ExpiresAt != nil {
+			if remaining := time.Until(*url.ExpiresAt); remaining < maxAge {
+				maxAge = remaining
+			}
+		}
+	}
+
+	destination, variant := s.destinationFor(url, visit)
+
+	return &domain.Redirect{
+		URL:         url,
+		Location:    passThrough(withUTM(destination, url, shortCode), url, visit),
+		StatusCode:  status,
+		CacheMaxAge: maxAge,
+		Destination: destination,
+		Variant:     variant,
+	}, nil
+}
+
+// GetURLInfo looks a link up by its domain, which may be spelled as any Host
+// header would, and code, with its current access counts.
+func (s *URLService) GetURLInfo(ctx context.Context, host, shortCode string) (*domain.URL, error) {
+	url, err := s.findLink(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cached link keeps the counts it was cached with.
+	url.AccessCount, url.LastAccessedAt, err = s.repo.FindAccess(ctx, s.namespace(host), shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// findLink looks a link up without its current access counts, which visits
+// do not need.
+func (s *URLService) findLink(ctx context.Context, host, shortCode string) (*domain.URL, error) {
+	url, err := s.repo.FindByShortURL(ctx, s.namespace(host), shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if url.IsExpired(time.Now()) {
+		return nil, domain.ErrExpired
 	}
 
 	if !hasProtocol(url.LongURL) {
 		url.LongURL = "https://" + url.LongURL
 	}
 
-	if err := s.repo.Save(ctx, url); err != nil {
-		return nil, fmt.Errorf("failed to update last access: %w", err)
+	url.ShortURL = s.shortLink(url, url.ShortURL)
+
+	return url, nil
+}
+
+// PreviewURL looks up a link to describe it to a visitor without following
+// it. Nothing is counted, but like a visit it fails for links that are not
+// active yet, have used up their clicks or do not forward the visit's path.
+func (s *URLService) PreviewURL(ctx context.Context, host, shortCode string, visit domain.Visit) (*domain.URL, error) {
+	url, err := s.findLive(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPath(url, visit); err != nil {
+		return nil, err
+	}
+	if err := s.checkClicks(ctx, shortCode, url); err != nil {
+		return nil, err
+	}
+	return url, nil
+}
+
+// findLive looks up a link for a visit, which unlike findLink also
+// requires the link to have reached its activation time.
+func (s *URLService) findLive(ctx context.Context, host, shortCode string) (*domain.URL, error) {
+	url, err := s.findLink(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
 	}
 
-	url.ShortURL = fmt.Sprintf("%s/%s", s.baseURL, url.ShortURL)
+	if !url.IsActive(time.Now()) {
+		return nil, &domain.NotActiveError{ActivatesAt: *url.ActivatesAt}
+	}
 
 	return url, nil
 }
 
-func generateShortCode() (string, error) {
-	b := make([]byte, 6)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+func validateRedirectType(status int) error {
+	switch status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	default:
+		return ErrInvalidRedirectType
 	}
-	return base64.URLEncoding.EncodeToString(b)[:8], nil
+}
+
+func validateTitle(title string) error {
+	if len([]rune(title)) > maxTitleLength {
+		return ErrTitleTooLong
+	}
+	return nil
+}
+
+func validateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return ErrInvalidAlias
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return ErrReservedAlias
+	}
+	return nil
 }
 
 func hasProtocol(url string) bool {
 	return len(url) > 7 && (url[:7] == "http://" || url[:8] == "https://")
 }
 
-func (s *URLService) DeleteURL(ctx context.Context, shortCode string) error {
+func (s *URLService) UpdateURL(ctx context.Context, host, shortCode string, opts domain.UpdateOptions) (*domain.URL, error) {
+	host = s.namespace(host)
+	url, err := s.repo.FindByShortURL(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]domain.FieldChange)
+
+	if opts.LongURL != nil {
+		longURL := *opts.LongURL
+		if !hasProtocol(longURL) {
+			longURL = "https://" + longURL
+		}
+		// An unchanged destination is not resolved again, which could
+		// request other shorteners or reject a link saved before they were.
+		if longURL != url.LongURL {
+			longURL, err = s.resolveChain(ctx, longURL)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if longURL != url.LongURL {
+			if err := s.checkDestinations(ctx, longURL); err != nil {
+				return nil, err
+			}
+			changes["long_url"] = domain.FieldChange{From: url.LongURL, To: longURL}
+			url.LongURL = longURL
+			url.LongURLHash = hashURL(longURL)
+		}
+	}
+
+	if opts.Title != nil && *opts.Title != url.Title {
+		if err := validateTitle(*opts.Title); err != nil {
+			return nil, err
+		}
+		changes["title"] = domain.FieldChange{From: url.Title, To: *opts.Title}
+		url.Title = *opts.Title
+	}
+
+	if opts.RedirectType != nil && *opts.RedirectType != url.RedirectType {
+		if err := validateRedirectType(*opts.RedirectType); err != nil {
+			return nil, err
+		}
+		changes["redirect_type"] = domain.FieldChange{From: url.RedirectType, To: *opts.RedirectType}
+		url.RedirectType = *opts.RedirectType
+	}
+
+	if opts.Password != nil {
+		var hash string
+		if *opts.Password != "" {
+			hash, err = hashPassword(*opts.Password)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if hash != "" || url.IsProtected() {
+			changes["password"] = domain.FieldChange{From: url.IsProtected(), To: hash != ""}
+			url.PasswordHash = hash
+		}
+	}
+
+	if opts.MaxClicks != nil && *opts.MaxClicks != url.MaxClicks {
+		if err := validateMaxClicks(*opts.MaxClicks); err != nil {
+			return nil, err
+		}
+		changes["max_clicks"] = domain.FieldChange{From: url.MaxClicks, To: *opts.MaxClicks}
+		url.MaxClicks = *opts.MaxClicks
+	}
+
+	if opts.Rules != nil {
+		rules, err := normalizeRules(*opts.Rules)
+		if err != nil {
+			return nil, err
+		}
+		if !sameRules(url.Rules, rules) {
+			if _, err := s.resolveDestinations(ctx, "", rules, nil); err != nil {
+				return nil, err
+			}
+		}
+		if !sameRules(url.Rules, rules) {
+			if err := s.checkDestinations(ctx, linkDestinations("", rules, nil)...); err != nil {
+				return nil, err
+			}
+			changes["rules"] = domain.FieldChange{From: url.Rules, To: rules}
+			url.Rules = rules
+		}
+	}
+
+	if opts.Variants != nil {
+		variants, err := normalizeVariants(*opts.Variants)
+		if err != nil {
+			return nil, err
+		}
+		if !sameVariants(url.Variants, variants) {
+			if _, err := s.resolveDestinations(ctx, "", nil, variants); err != nil {
+				return nil, err
+			}
+		}
+		if !sameVariants(url.Variants, variants) {
+			if err := s.checkDestinations(ctx, linkDestinations("", nil, variants)...); err != nil {
+				return nil, err
+			}
+			changes["variants"] = domain.FieldChange{From: url.Variants, To: variants}
+			url.Variants = variants
+		}
+	}
+
+	if opts.QueryMerge != nil && *opts.QueryMerge != url.QueryMerge {
+		if err := validateQueryMerge(*opts.QueryMerge); err != nil {
+			return nil, err
+		}
+		changes["query_merge"] = domain.FieldChange{From: url.QueryMerge, To: *opts.QueryMerge}
+		url.QueryMerge = *opts.QueryMerge
+	}
 
-	_, err := s.repo.FindByShortURL(ctx, shortCode)
+	if opts.PathPassthrough != nil && *opts.PathPassthrough != url.PathPassthrough {
+		changes["path_passthrough"] = domain.FieldChange{From: url.PathPassthrough, To: *opts.PathPassthrough}
+		url.PathPassthrough = *opts.PathPassthrough
+	}
+
+	if opts.Preview != nil && *opts.Preview != url.Preview {
+		changes["preview"] = domain.FieldChange{From: url.Preview, To: *opts.Preview}
+		url.Preview = *opts.Preview
+	}
+
+	if opts.UTM != nil {
+		utm, err := normalizeUTM(*opts.UTM)
+		if err != nil {
+			return nil, err
+		}
+		if utm != url.UTM {
+			changes["utm"] = domain.FieldChange{From: url.UTM, To: utm}
+			url.UTM = utm
+		}
+	}
+
+	if opts.Description != nil && *opts.Description != url.Description {
+		changes["description"] = domain.FieldChange{From: url.Description, To: *opts.Description}
+		url.Description = *opts.Description
+	}
+
+	if opts.ImageURL != nil && *opts.ImageURL != url.ImageURL {
+		if err := validateImageURL(*opts.ImageURL); err != nil {
+			return nil, err
+		}
+		changes["image_url"] = domain.FieldChange{From: url.ImageURL, To: *opts.ImageURL}
+		url.ImageURL = *opts.ImageURL
+	}
+
+	if opts.ActivateNow {
+		if opts.ActivatesAt != nil {
+			return nil, fmt.Errorf("%w: activates_at and activate_now are mutually exclusive", ErrInvalidActivation)
+		}
+		if url.ActivatesAt != nil {
+			changes["activates_at"] = domain.FieldChange{From: url.ActivatesAt, To: nil}
+			url.ActivatesAt = nil
+		}
+	}
+
+	if opts.ActivatesAt != nil && !sameTime(url.ActivatesAt, opts.ActivatesAt) {
+		changes["activates_at"] = domain.FieldChange{From: url.ActivatesAt, To: opts.ActivatesAt}
+		url.ActivatesAt = opts.ActivatesAt
+	}
+
+	if opts.HasExpiration() {
+		expiresAt, err := s.resolveExpiration(domain.ShortenOptions{
+			ExpiresAt:    opts.ExpiresAt,
+			TTL:          opts.TTL,
+			NeverExpires: opts.NeverExpires,
+		}, activationStart(url.ActivatesAt, time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		if !sameTime(url.ExpiresAt, expiresAt) {
+			changes["expires_at"] = domain.FieldChange{From: url.ExpiresAt, To: expiresAt}
+			url.ExpiresAt = expiresAt
+		}
+	}
+
+	if url.ActivatesAt != nil && url.ExpiresAt != nil && !url.ExpiresAt.After(*url.ActivatesAt) {
+		return nil, fmt.Errorf("%w: activates_at must be before expires_at", ErrInvalidActivation)
+	}
+
+	// The count is moved first: should the update fail, a retry moves it
+	// again, while it could not once the new expiry is stored.
+	if _, ok := changes["expires_at"]; ok {
+		if err := s.expireClicks(ctx, shortCode, url); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(changes) > 0 {
+		data, err := json.Marshal(changes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode changes: %w", err)
+		}
+
+		actor := opts.Actor
+		if actor == "" {
+			actor = anonymousActor
+		}
+
+		audit := &domain.AuditEntry{
+			URLID:     url.ID,
+			ShortURL:  url.ShortURL,
+			Actor:     actor,
+			Action:    "update",
+			Changes:   string(data),
+			CreatedAt: time.Now(),
+		}
+		if err := s.repo.Update(ctx, url, audit); err != nil {
+			return nil, fmt.Errorf("failed to update URL: %w", err)
+		}
+	}
+
+	url.ShortURL = s.shortLink(url, url.ShortURL)
+
+	return url, nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (s *URLService) DeleteURL(ctx context.Context, host, shortCode string) error {
+	host = s.namespace(host)
+
+	_, err := s.repo.FindByShortURL(ctx, host, shortCode)
 	if err != nil {
-		return fmt.Errorf("URL not found: %w", err)
+		return err
 	}
 
-	if err := s.repo.Delete(ctx, shortCode); err != nil {
+	if err := s.repo.Delete(ctx, host, shortCode); err != nil {
 		return fmt.Errorf("failed to delete URL: %w", err)
 	}
 
@@ -109,3 +788,49 @@ func (s *URLService) DeleteURL(ctx context.Context, shortCode string) error {
 
 	return nil
 }
+
+func (s *URLService) ListURLs(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	urls, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, url := range urls {
+		url.ShortURL = s.shortLink(url, url.ShortURL)
+	}
+
+	return urls, nil
+}
+
+func (s *URLService) RestoreURL(ctx context.Context, host, shortCode string) error {
+	host = s.namespace(host)
+	if err := s.repo.Restore(ctx, host, shortCode); err != nil {
+		return fmt.Errorf("failed to restore URL: %w", err)
+	}
+
+	metrics.IncrementActiveURLs()
+
+	return nil
+}
+
+// PurgeURL permanently deletes a link so its short code can be issued again.
+func (s *URLService) PurgeURL(ctx context.Context, host, shortCode string) error {
+	host = s.namespace(host)
+	_, findErr := s.repo.FindByShortURL(ctx, host, shortCode)
+
+	if err := s.repo.Purge(ctx, host, shortCode); err != nil {
+		return fmt.Errorf("failed to purge URL: %w", err)
+	}
+
+	if findErr == nil {
+		metrics.DecrementActiveURLs()
+	}
+
+	if s.clicks != nil {
+		if err := s.clicks.ResetLinkCounters(ctx, domain.LinkKey(host, shortCode)); err != nil {
+			return fmt.Errorf("failed to reset link counters: %w", err)
+		}
+	}
+
+	return nil
+}
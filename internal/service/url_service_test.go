@@ -2,51 +2,182 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net/http"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/kakuzops/ml-url/internal/domain"
+	"github.com/kakuzops/ml-url/internal/repository"
+	"github.com/redis/go-redis/v9"
 )
 
 type mockRepository struct {
 	urls    map[string]*domain.URL
+	deleted map[string]*domain.URL
+	audits  []*domain.AuditEntry
 	baseURL string
 }
 
 func newMockRepository() *mockRepository {
 	return &mockRepository{
 		urls:    make(map[string]*domain.URL),
+		deleted: make(map[string]*domain.URL),
 		baseURL: "http://url.li",
 	}
 }
 
+// The mock keys links by domain.LinkKey, so links on the primary domain are
+// found under their bare code.
+func (m *mockRepository) Create(ctx context.Context, url *domain.URL) error {
+	key := domain.LinkKey(url.Domain, url.ShortURL)
+	if _, exists := m.urls[key]; exists {
+		return domain.ErrShortURLTaken
+	}
+	if _, exists := m.deleted[key]; exists {
+		return domain.ErrShortURLTaken
+	}
+	stored := *url
+	m.urls[key] = &stored
+	return nil
+}
+
 func (m *mockRepository) Save(ctx context.Context, url *domain.URL) error {
 	shortCode := strings.TrimPrefix(url.ShortURL, m.baseURL+"/")
 	m.urls[shortCode] = url
 	return nil
 }
 
-func (m *mockRepository) FindByShortURL(ctx context.Context, shortCode string) (*domain.URL, error) {
-	url, exists := m.urls[shortCode]
+func (m *mockRepository) Update(ctx context.Context, url *domain.URL, audit *domain.AuditEntry) error {
+	key := domain.LinkKey(url.Domain, url.ShortURL)
+	if _, exists := m.urls[key]; !exists {
+		return domain.ErrNotFound
+	}
+	stored := *url
+	m.urls[key] = &stored
+	m.audits = append(m.audits, audit)
+	return nil
+}
+
+func (m *mockRepository) FindByShortURL(ctx context.Context, host, shortCode string) (*domain.URL, error) {
+	key := domain.LinkKey(host, shortCode)
+	url, exists := m.urls[key]
 	if !exists {
-		return nil, fmt.Errorf("URL not found")
+		if _, deleted := m.deleted[key]; deleted {
+			return nil, domain.ErrDeleted
+		}
+		return nil, domain.ErrNotFound
 	}
-	return url, nil
+	copied := *url
+	return &copied, nil
 }
 
-func (m *mockRepository) Delete(ctx context.Context, shortCode string) error {
-	delete(m.urls, shortCode)
+func (m *mockRepository) FindByLongURLHash(ctx context.Context, host, hash string, owner *string) (*domain.URL, error) {
+	for _, url := range m.urls {
+		if url.Domain != host || url.LongURLHash != hash || url.IsExpired(time.Now()) || !url.IsActive(time.Now()) || url.IsProtected() || url.HasClickLimit() || len(url.Rules) > 0 || len(url.Variants) > 0 ||
+			url.RedirectType != 0 || url.Title != "" || url.Description != "" || url.ImageURL != "" ||
+			url.QueryMerge != "" || url.PathPassthrough || !url.UTM.IsZero() || url.Preview {
+			continue
+		}
+		if owner != nil && url.Owner != *owner {
+			continue
+		}
+		copied := *url
+		return &copied, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (m *mockRepository) RecordAccesses(ctx context.Context, batches []domain.AccessBatch) error {
+	for _, batch := range batches {
+		url, exists := m.urls[domain.LinkKey(batch.Domain, batch.ShortURL)]
+		if !exists {
+			continue
+		}
+		url.AccessCount += batch.Count
+		lastAccessedAt := batch.LastAccessedAt
+		url.LastAccessedAt = &lastAccessedAt
+	}
 	return nil
 }
 
+func (m *mockRepository) FindAccess(ctx context.Context, host, shortCode string) (int64, *time.Time, error) {
+	url, exists := m.urls[domain.LinkKey(host, shortCode)]
+	if !exists {
+		return 0, nil, domain.ErrNotFound
+	}
+	return url.AccessCount, url.LastAccessedAt, nil
+}
+
+func (m *mockRepository) List(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	source := m.urls
+	if filter.Deleted {
+		source = m.deleted
+	}
+	var urls []*domain.URL
+	for _, url := range source {
+		if filter.Owner != nil && url.Owner != *filter.Owner {
+			continue
+		}
+		copied := *url
+		urls = append(urls, &copied)
+	}
+	return urls, nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, host, shortCode string) error {
+	key := domain.LinkKey(host, shortCode)
+	if url, exists := m.urls[key]; exists {
+		m.deleted[key] = url
+	}
+	delete(m.urls, key)
+	return nil
+}
+
+func (m *mockRepository) Restore(ctx context.Context, host, shortCode string) error {
+	key := domain.LinkKey(host, shortCode)
+	url, exists := m.deleted[key]
+	if !exists {
+		return domain.ErrNotFound
+	}
+	delete(m.deleted, key)
+	m.urls[key] = url
+	return nil
+}
+
+func (m *mockRepository) Purge(ctx context.Context, host, shortCode string) error {
+	key := domain.LinkKey(host, shortCode)
+	_, active := m.urls[key]
+	_, deleted := m.deleted[key]
+	if !active && !deleted {
+		return domain.ErrNotFound
+	}
+	delete(m.urls, key)
+	delete(m.deleted, key)
+	return nil
+}
+
+type stubCodeGenerator struct {
+	codes []string
+}
+
+func (g *stubCodeGenerator) Generate(ctx context.Context) (string, error) {
+	code := g.codes[0]
+	if len(g.codes) > 1 {
+		g.codes = g.codes[1:]
+	}
+	return code, nil
+}
+
 func TestShortenURL(t *testing.T) {
 	repo := newMockRepository()
 	service := NewURLService(repo, "http://url.li", 24*time.Hour)
 
 	longURL := "https://www.google.com.br"
-	url, err := service.ShortenURL(context.Background(), longURL)
+	url, err := service.ShortenURL(context.Background(), longURL, domain.ShortenOptions{})
 
 	if err != nil {
 		t.Errorf("Erro inesperado ao encurtar URL: %v", err)
@@ -66,21 +197,21 @@ func TestShortenURL(t *testing.T) {
 	}
 }
 
-func TestGetLongURL(t *testing.T) {
+func TestResolveRedirectToLongURL(t *testing.T) {
 	repo := newMockRepository()
 	service := NewURLService(repo, "http://url.li", 24*time.Hour)
 
 	longURL := "https://www.google.com.br"
-	url, _ := service.ShortenURL(context.Background(), longURL)
+	url, _ := service.ShortenURL(context.Background(), longURL, domain.ShortenOptions{})
 	shortCode := strings.TrimPrefix(url.ShortURL, "http://url.li/")
 
-	retrievedURL, err := service.GetLongURL(context.Background(), shortCode)
+	redirect, err := service.ResolveRedirect(context.Background(), "", shortCode, domain.Visit{})
 	if err != nil {
-		t.Errorf("Erro inesperado ao recuperar URL: %v", err)
+		t.Fatalf("Erro inesperado ao recuperar URL: %v", err)
 	}
 
-	if retrievedURL != longURL {
-		t.Errorf("URL longa esperada %s, obtida %s", longURL, retrievedURL)
+	if redirect.Location != longURL {
+		t.Errorf("URL longa esperada %s, obtida %s", longURL, redirect.Location)
 	}
 }
 
@@ -89,18 +220,43 @@ func TestGetExpiredURL(t *testing.T) {
 	service := NewURLService(repo, "http://url.li", 24*time.Hour)
 
 	shortCode := "expired"
+	expiresAt := time.Now().Add(-1 * time.Hour)
 	url := &domain.URL{
 		ID:        "test_id",
 		LongURL:   "https://www.google.com.br",
 		ShortURL:  "http://url.li/" + shortCode,
 		CreatedAt: time.Now().Add(-25 * time.Hour),
-		ExpiresAt: time.Now().Add(-1 * time.Hour),
+		ExpiresAt: &expiresAt,
 	}
 	repo.Save(context.Background(), url)
 
-	_, err := service.GetLongURL(context.Background(), shortCode)
-	if err == nil {
-		t.Error("Esperado erro de URL expirada, mas nenhum erro foi retornado")
+	_, err := service.ResolveRedirect(context.Background(), "", shortCode, domain.Visit{})
+	if !errors.Is(err, domain.ErrExpired) {
+		t.Errorf("Esperado ErrExpired, obtido %v", err)
+	}
+}
+
+func TestGetURLInfoErrors(t *testing.T) {
+	repo := newMockRepository()
+	service := NewURLService(repo, "http://url.li", 24*time.Hour)
+
+	if _, err := service.GetURLInfo(context.Background(), "", "naoexiste"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Esperado ErrNotFound, obtido %v", err)
+	}
+
+	url, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "apagado"})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	if err := service.DeleteURL(context.Background(), "", strings.TrimPrefix(url.ShortURL, "http://url.li/")); err != nil {
+		t.Fatalf("Erro inesperado ao deletar URL: %v", err)
+	}
+
+	if _, err := service.GetURLInfo(context.Background(), "", "apagado"); !errors.Is(err, domain.ErrDeleted) {
+		t.Errorf("Esperado ErrDeleted, obtido %v", err)
+	}
+	if err := service.DeleteURL(context.Background(), "", "apagado"); !errors.Is(err, domain.ErrDeleted) {
+		t.Errorf("Esperado ErrDeleted ao deletar novamente, obtido %v", err)
 	}
 }
 
@@ -111,26 +267,26 @@ func TestDeleteURL(t *testing.T) {
 
 	t.Run("Delete existing URL", func(t *testing.T) {
 		longURL := "https://www.example.com"
-		url, err := service.ShortenURL(context.Background(), longURL)
+		url, err := service.ShortenURL(context.Background(), longURL, domain.ShortenOptions{})
 		if err != nil {
 			t.Fatalf("Erro inesperado ao criar URL: %v", err)
 		}
 
 		shortCode := strings.TrimPrefix(url.ShortURL, "http://url.li/")
 
-		err = service.DeleteURL(context.Background(), shortCode)
+		err = service.DeleteURL(context.Background(), "", shortCode)
 		if err != nil {
 			t.Errorf("Erro inesperado ao deletar URL: %v", err)
 		}
 
-		_, err = service.GetURLInfo(context.Background(), shortCode)
+		_, err = service.GetURLInfo(context.Background(), "", shortCode)
 		if err == nil {
 			t.Error("URL ainda existe após deleção")
 		}
 	})
 
 	t.Run("Delete non-existing URL", func(t *testing.T) {
-		err := service.DeleteURL(context.Background(), "naoexiste")
+		err := service.DeleteURL(context.Background(), "", "naoexiste")
 		if err == nil {
 			t.Error("Esperado erro ao deletar URL inexistente, mas nenhum erro foi retornado")
 		}
@@ -138,21 +294,921 @@ func TestDeleteURL(t *testing.T) {
 
 	t.Run("Delete already deleted URL", func(t *testing.T) {
 		longURL := "https://www.example.com"
-		url, err := service.ShortenURL(context.Background(), longURL)
+		url, err := service.ShortenURL(context.Background(), longURL, domain.ShortenOptions{})
 		if err != nil {
 			t.Fatalf("Erro inesperado ao criar URL: %v", err)
 		}
 
 		shortCode := strings.TrimPrefix(url.ShortURL, "http://url.li/")
 
-		err = service.DeleteURL(context.Background(), shortCode)
+		err = service.DeleteURL(context.Background(), "", shortCode)
 		if err != nil {
 			t.Errorf("Erro inesperado ao deletar URL: %v", err)
 		}
 
-		err = service.DeleteURL(context.Background(), shortCode)
+		err = service.DeleteURL(context.Background(), "", shortCode)
 		if err == nil {
 			t.Error("Esperado erro ao deletar URL já deletada, mas nenhum erro foi retornado")
 		}
 	})
 }
+
+func TestShortenURLWithAlias(t *testing.T) {
+	repo := newMockRepository()
+	service := NewURLService(repo, "http://url.li", 24*time.Hour)
+
+	t.Run("Alias disponível", func(t *testing.T) {
+		url, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "black-friday"})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao criar alias: %v", err)
+		}
+		if url.ShortURL != "http://url.li/black-friday" {
+			t.Errorf("URL curta esperada http://url.li/black-friday, obtida %s", url.ShortURL)
+		}
+	})
+
+	t.Run("Alias já utilizado", func(t *testing.T) {
+		_, err := service.ShortenURL(context.Background(), "https://www.other.com", domain.ShortenOptions{Alias: "black-friday"})
+		if !errors.Is(err, ErrAliasTaken) {
+			t.Errorf("Esperado ErrAliasTaken, obtido %v", err)
+		}
+		if repo.urls["black-friday"].LongURL != "https://www.example.com" {
+			t.Error("Alias existente foi sobrescrito")
+		}
+	})
+
+	t.Run("Alias reservado", func(t *testing.T) {
+		_, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "Metrics"})
+		if !errors.Is(err, ErrReservedAlias) {
+			t.Errorf("Esperado ErrReservedAlias, obtido %v", err)
+		}
+	})
+
+	t.Run("Alias inválido", func(t *testing.T) {
+		for _, alias := range []string{"ab", "com espaço", "barra/invalida", strings.Repeat("a", 33)} {
+			_, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: alias})
+			if !errors.Is(err, ErrInvalidAlias) {
+				t.Errorf("Esperado ErrInvalidAlias para %q, obtido %v", alias, err)
+			}
+		}
+	})
+}
+
+func TestShortenURLCollision(t *testing.T) {
+	t.Run("Nova tentativa após colisão", func(t *testing.T) {
+		repo := newMockRepository()
+		repo.urls["ocupado1"] = &domain.URL{ShortURL: "ocupado1", LongURL: "https://www.original.com"}
+		generator := &stubCodeGenerator{codes: []string{"ocupado1", "livre123"}}
+		service := NewURLService(repo, "http://url.li", 24*time.Hour, WithCodeGenerator(generator))
+
+		url, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao encurtar URL: %v", err)
+		}
+		if url.ShortURL != "http://url.li/livre123" {
+			t.Errorf("URL curta esperada http://url.li/livre123, obtida %s", url.ShortURL)
+		}
+		if repo.urls["ocupado1"].LongURL != "https://www.original.com" {
+			t.Error("URL existente foi sobrescrita pela colisão")
+		}
+	})
+
+	t.Run("Espaço de códigos esgotado", func(t *testing.T) {
+		repo := newMockRepository()
+		repo.urls["ocupado1"] = &domain.URL{ShortURL: "ocupado1", LongURL: "https://www.original.com"}
+		generator := &stubCodeGenerator{codes: []string{"ocupado1"}}
+		service := NewURLService(repo, "http://url.li", 24*time.Hour, WithCodeGenerator(generator))
+
+		_, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{})
+		if !errors.Is(err, ErrShortCodeExhausted) {
+			t.Errorf("Esperado ErrShortCodeExhausted, obtido %v", err)
+		}
+	})
+}
+
+func TestShortenURLDedupe(t *testing.T) {
+	enabled, disabled := true, false
+
+	t.Run("Mesma URL retorna link existente", func(t *testing.T) {
+		repo := newMockRepository()
+		service := NewURLService(repo, "http://url.li", 24*time.Hour, WithDeduplication(true, false))
+
+		first, err := service.ShortenURL(context.Background(), "https://www.Example.com:443/page?b=2&a=1#top", domain.ShortenOptions{})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao encurtar URL: %v", err)
+		}
+		second, err := service.ShortenURL(context.Background(), "https://www.example.com/page?a=1&b=2", domain.ShortenOptions{})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao encurtar URL: %v", err)
+		}
+
+		if first.ShortURL != second.ShortURL {
+			t.Errorf("Esperado mesmo link curto, obtidos %s e %s", first.ShortURL, second.ShortURL)
+		}
+		if !second.Existing {
+			t.Error("Link reutilizado deveria ser marcado como existente")
+		}
+		if len(repo.urls) != 1 {
+			t.Errorf("Esperado 1 link salvo, obtidos %d", len(repo.urls))
+		}
+	})
+
+	t.Run("Escopo por dono", func(t *testing.T) {
+		repo := newMockRepository()
+		service := NewURLService(repo, "http://url.li", 24*time.Hour, WithDeduplication(true, true))
+
+		first, _ := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Owner: "ana"})
+		second, _ := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Owner: "bruno"})
+		third, _ := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Owner: "ana"})
+
+		if first.ShortURL == second.ShortURL {
+			t.Error("Donos diferentes não deveriam compartilhar link")
+		}
+		if first.ShortURL != third.ShortURL {
+			t.Errorf("Esperado mesmo link para o mesmo dono, obtidos %s e %s", first.ShortURL, third.ShortURL)
+		}
+	})
+
+	t.Run("Flag da requisição sobrescreve configuração", func(t *testing.T) {
+		repo := newMockRepository()
+		service := NewURLService(repo, "http://url.li", 24*time.Hour)
+
+		first, _ := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Dedupe: &enabled})
+		second, _ := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Dedupe: &enabled})
+		third, _ := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Dedupe: &disabled})
+
+		if first.ShortURL != second.ShortURL {
+			t.Errorf("Esperado mesmo link com dedupe ativo, obtidos %s e %s", first.ShortURL, second.ShortURL)
+		}
+		if first.ShortURL == third.ShortURL {
+			t.Error("Dedupe desativado deveria criar novo link")
+		}
+	})
+	t.Run("Tipo de redirecionamento e metadados não são reutilizados", func(t *testing.T) {
+		repo := newMockRepository()
+		service := NewURLService(repo, "http://url.li", 24*time.Hour, WithDeduplication(true, false))
+		ctx := context.Background()
+
+		plain, _ := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{})
+		for name, opts := range map[string]domain.ShortenOptions{
+			"redirect_type": {RedirectType: http.StatusMovedPermanently},
+			"title":         {Title: "Promoção"},
+			"description":   {Description: "Ofertas da semana"},
+			"image_url":     {ImageURL: "https://cdn.example.com/card.png"},
+		} {
+			url, err := service.ShortenURL(ctx, "https://www.example.com", opts)
+			if err != nil {
+				t.Fatalf("%s: erro inesperado ao encurtar URL: %v", name, err)
+			}
+			if url.Existing || url.ShortURL == plain.ShortURL {
+				t.Errorf("%s: link com opções próprias não deveria reutilizar %s", name, plain.ShortURL)
+			}
+		}
+
+		delete(repo.urls, domain.LinkKey("", strings.TrimPrefix(plain.ShortURL, "http://url.li/")))
+		again, _ := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{})
+		if again.Existing {
+			t.Errorf("Link simples não deveria reutilizar um link com opções próprias, obtido %s", again.ShortURL)
+		}
+	})
+}
+
+func TestShortenURLExpiration(t *testing.T) {
+	repo := newMockRepository()
+	service := NewURLService(repo, "http://url.li", 24*time.Hour, WithExpirationBounds(time.Hour, 30*24*time.Hour, true))
+
+	t.Run("TTL por link", func(t *testing.T) {
+		url, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{TTL: 72 * time.Hour})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao encurtar URL: %v", err)
+		}
+		if remaining := time.Until(*url.ExpiresAt); remaining < 71*time.Hour || remaining > 72*time.Hour {
+			t.Errorf("Expiração esperada em 72h, obtida em %s", remaining)
+		}
+	})
+
+	t.Run("Data de expiração explícita", func(t *testing.T) {
+		expiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+		url, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{ExpiresAt: &expiresAt})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao encurtar URL: %v", err)
+		}
+		if !url.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("Expiração esperada %s, obtida %s", expiresAt, url.ExpiresAt)
+		}
+	})
+
+	t.Run("Link permanente", func(t *testing.T) {
+		url, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{NeverExpires: true})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao encurtar URL: %v", err)
+		}
+		if !url.NeverExpires() {
+			t.Error("Link deveria ser permanente")
+		}
+
+		shortCode := strings.TrimPrefix(url.ShortURL, "http://url.li/")
+		if _, err := service.ResolveRedirect(context.Background(), "", shortCode, domain.Visit{}); err != nil {
+			t.Errorf("Erro inesperado ao recuperar link permanente: %v", err)
+		}
+	})
+
+	t.Run("Limites do servidor", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		for _, opts := range []domain.ShortenOptions{
+			{TTL: 10 * time.Minute},
+			{TTL: 60 * 24 * time.Hour},
+			{ExpiresAt: &past},
+			{TTL: 2 * time.Hour, NeverExpires: true},
+		} {
+			_, err := service.ShortenURL(context.Background(), "https://www.example.com", opts)
+			if !errors.Is(err, ErrInvalidExpiration) {
+				t.Errorf("Esperado ErrInvalidExpiration para %+v, obtido %v", opts, err)
+			}
+		}
+	})
+
+	t.Run("Links permanentes desabilitados", func(t *testing.T) {
+		strict := NewURLService(repo, "http://url.li", 24*time.Hour, WithExpirationBounds(time.Hour, 0, false))
+		_, err := strict.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{NeverExpires: true})
+		if !errors.Is(err, ErrPermanentNotAllowed) {
+			t.Errorf("Esperado ErrPermanentNotAllowed, obtido %v", err)
+		}
+	})
+}
+
+func TestUpdateURL(t *testing.T) {
+	repo := newMockRepository()
+	service := NewURLService(repo, "http://url.li", 24*time.Hour, WithExpirationBounds(time.Hour, 0, true))
+
+	url, err := service.ShortenURL(context.Background(), "https://www.exmaple.com", domain.ShortenOptions{Alias: "campanha"})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	previousHash := repo.urls["campanha"].LongURLHash
+
+	t.Run("Atualiza destino e expiração", func(t *testing.T) {
+		longURL := "https://www.example.com"
+		title := "Campanha"
+		updated, err := service.UpdateURL(context.Background(), "", "campanha", domain.UpdateOptions{
+			Actor:   "ana",
+			LongURL: &longURL,
+			Title:   &title,
+			TTL:     30 * 24 * time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao atualizar URL: %v", err)
+		}
+
+		if updated.ShortURL != url.ShortURL {
+			t.Errorf("URL curta esperada %s, obtida %s", url.ShortURL, updated.ShortURL)
+		}
+		stored := repo.urls["campanha"]
+		if stored.LongURL != longURL || stored.Title != title {
+			t.Errorf("Destino ou título não atualizados: %+v", stored)
+		}
+		if stored.LongURLHash == previousHash {
+			t.Error("Hash da URL longa deveria ser recalculado")
+		}
+		if time.Until(*stored.ExpiresAt) < 29*24*time.Hour {
+			t.Errorf("Expiração não foi estendida: %s", stored.ExpiresAt)
+		}
+
+		if len(repo.audits) != 1 {
+			t.Fatalf("Esperado 1 registro de auditoria, obtidos %d", len(repo.audits))
+		}
+		audit := repo.audits[0]
+		if audit.Actor != "ana" || audit.Action != "update" {
+			t.Errorf("Auditoria inesperada: %+v", audit)
+		}
+		for _, field := range []string{"long_url", "title", "expires_at"} {
+			if !strings.Contains(audit.Changes, field) {
+				t.Errorf("Auditoria deveria registrar alteração de %s: %s", field, audit.Changes)
+			}
+		}
+	})
+
+	t.Run("Sem alterações não gera auditoria", func(t *testing.T) {
+		longURL := "https://www.example.com"
+		if _, err := service.UpdateURL(context.Background(), "", "campanha", domain.UpdateOptions{LongURL: &longURL}); err != nil {
+			t.Fatalf("Erro inesperado ao atualizar URL: %v", err)
+		}
+		if len(repo.audits) != 1 {
+			t.Errorf("Esperado 1 registro de auditoria, obtidos %d", len(repo.audits))
+		}
+	})
+
+	t.Run("Expiração inválida", func(t *testing.T) {
+		_, err := service.UpdateURL(context.Background(), "", "campanha", domain.UpdateOptions{TTL: time.Minute})
+		if !errors.Is(err, ErrInvalidExpiration) {
+			t.Errorf("Esperado ErrInvalidExpiration, obtido %v", err)
+		}
+	})
+
+	t.Run("URL inexistente", func(t *testing.T) {
+		_, err := service.UpdateURL(context.Background(), "", "naoexiste", domain.UpdateOptions{})
+		if err == nil {
+			t.Error("Esperado erro ao atualizar URL inexistente, mas nenhum erro foi retornado")
+		}
+	})
+}
+
+func TestResolveRedirectRecordsAccess(t *testing.T) {
+	repo := newMockRepository()
+	recorder := NewAccessRecorder(repo, time.Hour)
+	service := NewURLService(repo, "http://url.li", 24*time.Hour, WithAccessRecorder(recorder))
+
+	if _, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "contado"}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+
+	if _, err := service.GetURLInfo(context.Background(), "", "contado"); err != nil {
+		t.Fatalf("Erro inesperado ao consultar URL: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := service.ResolveRedirect(context.Background(), "", "contado", domain.Visit{}); err != nil {
+			t.Fatalf("Erro inesperado ao recuperar URL: %v", err)
+		}
+	}
+
+	if repo.urls["contado"].AccessCount != 0 {
+		t.Error("Acessos não deveriam ser gravados antes do flush")
+	}
+
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("Erro inesperado no flush: %v", err)
+	}
+
+	stored := repo.urls["contado"]
+	if stored.AccessCount != 3 {
+		t.Errorf("Esperado 3 acessos, obtidos %d", stored.AccessCount)
+	}
+	if stored.LastAccessedAt == nil {
+		t.Error("Último acesso deveria ser registrado")
+	}
+}
+
+// staleCacheRepository serves links as a cache filled before any visit
+// would, with no access counts.
+type staleCacheRepository struct {
+	*mockRepository
+}
+
+func (r staleCacheRepository) FindByShortURL(ctx context.Context, host, shortCode string) (*domain.URL, error) {
+	url, err := r.mockRepository.FindByShortURL(ctx, host, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	url.AccessCount = 0
+	url.LastAccessedAt = nil
+	return url, nil
+}
+
+func TestGetURLInfoReadsCurrentAccessCounts(t *testing.T) {
+	repo := newMockRepository()
+	recorder := NewAccessRecorder(repo, time.Hour)
+	service := NewURLService(staleCacheRepository{repo}, "http://url.li", 24*time.Hour, WithAccessRecorder(recorder))
+
+	if _, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "contado"}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := service.ResolveRedirect(context.Background(), "", "contado", domain.Visit{}); err != nil {
+			t.Fatalf("Erro inesperado ao recuperar URL: %v", err)
+		}
+	}
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("Erro inesperado no flush: %v", err)
+	}
+
+	info, err := service.GetURLInfo(context.Background(), "", "contado")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao consultar URL: %v", err)
+	}
+	if info.AccessCount != 2 {
+		t.Errorf("Info deveria mostrar 2 acessos gravados mesmo com o link em cache, obtido %d", info.AccessCount)
+	}
+	if info.LastAccessedAt == nil {
+		t.Error("Info deveria mostrar o último acesso gravado")
+	}
+}
+
+func TestResolveRedirect(t *testing.T) {
+	repo := newMockRepository()
+	service := NewURLService(repo, "http://url.li", 24*time.Hour, WithRedirectPolicy(http.StatusFound, 48*time.Hour))
+
+	service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "padrao"})
+	service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "permanente", RedirectType: http.StatusMovedPermanently})
+
+	redirect, err := service.ResolveRedirect(context.Background(), "", "padrao", domain.Visit{})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao resolver redirecionamento: %v", err)
+	}
+	if redirect.StatusCode != http.StatusFound || redirect.CacheMaxAge != 0 {
+		t.Errorf("Esperado 302 sem cache, obtido %d com cache %s", redirect.StatusCode, redirect.CacheMaxAge)
+	}
+
+	redirect, err = service.ResolveRedirect(context.Background(), "", "permanente", domain.Visit{})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao resolver redirecionamento: %v", err)
+	}
+	if redirect.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Esperado 301, obtido %d", redirect.StatusCode)
+	}
+	if redirect.CacheMaxAge > 24*time.Hour || redirect.CacheMaxAge < 23*time.Hour {
+		t.Errorf("Cache deveria ser limitado à expiração do link, obtido %s", redirect.CacheMaxAge)
+	}
+
+	_, err = service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{RedirectType: http.StatusOK})
+	if !errors.Is(err, ErrInvalidRedirectType) {
+		t.Errorf("Esperado ErrInvalidRedirectType, obtido %v", err)
+	}
+}
+
+func TestSoftDeleteLifecycle(t *testing.T) {
+	repo := newMockRepository()
+	generator := &stubCodeGenerator{codes: []string{"apagado1", "novo1234"}}
+	service := NewURLService(repo, "http://url.li", 24*time.Hour, WithCodeGenerator(generator))
+
+	repo.deleted["apagado1"] = &domain.URL{ShortURL: "apagado1", LongURL: "https://www.antigo.com"}
+	repo.deleted["promo"] = &domain.URL{ShortURL: "promo", LongURL: "https://www.antigo.com", Owner: "ana"}
+
+	t.Run("Código apagado não é reutilizado", func(t *testing.T) {
+		url, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao encurtar URL: %v", err)
+		}
+		if url.ShortURL != "http://url.li/novo1234" {
+			t.Errorf("URL curta esperada http://url.li/novo1234, obtida %s", url.ShortURL)
+		}
+
+		_, err = service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "promo"})
+		if !errors.Is(err, ErrAliasTaken) {
+			t.Errorf("Esperado ErrAliasTaken para alias apagado, obtido %v", err)
+		}
+	})
+
+	t.Run("Listagem de apagados", func(t *testing.T) {
+		owner := "ana"
+		urls, err := service.ListURLs(context.Background(), domain.ListFilter{Deleted: true, Owner: &owner})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao listar URLs: %v", err)
+		}
+		if len(urls) != 1 || urls[0].ShortURL != "http://url.li/promo" {
+			t.Errorf("Esperado apenas http://url.li/promo, obtido %+v", urls)
+		}
+	})
+
+	t.Run("Restauração", func(t *testing.T) {
+		if err := service.RestoreURL(context.Background(), "", "apagado1"); err != nil {
+			t.Fatalf("Erro inesperado ao restaurar URL: %v", err)
+		}
+		if _, err := service.ResolveRedirect(context.Background(), "", "apagado1", domain.Visit{}); err != nil {
+			t.Errorf("URL restaurada deveria estar acessível: %v", err)
+		}
+		if err := service.RestoreURL(context.Background(), "", "apagado1"); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Esperado ErrNotFound ao restaurar URL ativa, obtido %v", err)
+		}
+	})
+
+	t.Run("Remoção definitiva libera o código", func(t *testing.T) {
+		if err := service.PurgeURL(context.Background(), "", "promo"); err != nil {
+			t.Fatalf("Erro inesperado ao remover URL: %v", err)
+		}
+		if _, err := service.ShortenURL(context.Background(), "https://www.example.com", domain.ShortenOptions{Alias: "promo"}); err != nil {
+			t.Errorf("Alias removido definitivamente deveria estar disponível: %v", err)
+		}
+		if err := service.PurgeURL(context.Background(), "", "naoexiste"); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Esperado ErrNotFound, obtido %v", err)
+		}
+	})
+}
+
+type stubAttemptLimiter struct {
+	attempts map[string]int
+	max      int
+}
+
+func (l *stubAttemptLimiter) Attempt(ctx context.Context, key string) (time.Duration, error) {
+	l.attempts[key]++
+	if l.attempts[key] > l.max {
+		return time.Minute, nil
+	}
+	return 0, nil
+}
+
+func (l *stubAttemptLimiter) Reset(ctx context.Context, key string) error {
+	delete(l.attempts, key)
+	return nil
+}
+
+func TestPasswordProtectedURL(t *testing.T) {
+	repo := newMockRepository()
+	limiter := &stubAttemptLimiter{attempts: make(map[string]int), max: 3}
+	service := NewURLService(repo, "http://url.li", 24*time.Hour,
+		WithDeduplication(true, false),
+		WithPasswordThrottle(limiter),
+	)
+	ctx := context.Background()
+
+	_, err := service.ShortenURL(ctx, "https://www.example.com/doc", domain.ShortenOptions{Alias: "secreto", Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL protegida: %v", err)
+	}
+
+	if stored := repo.urls["secreto"]; stored.PasswordHash == "" || stored.PasswordHash == "hunter2" {
+		t.Errorf("Senha deveria ser armazenada como hash, obtido %q", stored.PasswordHash)
+	}
+
+	if _, err := service.ResolveRedirect(ctx, "", "secreto", domain.Visit{}); !errors.Is(err, ErrPasswordRequired) {
+		t.Errorf("Esperado ErrPasswordRequired, obtido %v", err)
+	}
+
+	if _, err := service.UnlockRedirect(ctx, "", "secreto", "errada", domain.Visit{}); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Esperado ErrWrongPassword, obtido %v", err)
+	}
+
+	redirect, err := service.UnlockRedirect(ctx, "", "secreto", "hunter2", domain.Visit{})
+	if err != nil {
+		t.Fatalf("Erro inesperado com a senha correta: %v", err)
+	}
+	if redirect.Location != "https://www.example.com/doc" {
+		t.Errorf("Destino esperado https://www.example.com/doc, obtido %s", redirect.Location)
+	}
+	if limiter.attempts["secreto"] != 0 {
+		t.Errorf("Tentativas deveriam ser zeradas após acerto, obtido %d", limiter.attempts["secreto"])
+	}
+
+	t.Run("Bloqueio após tentativas erradas", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			service.UnlockRedirect(ctx, "", "secreto", "errada", domain.Visit{})
+		}
+		if _, err := service.UnlockRedirect(ctx, "", "secreto", "hunter2", domain.Visit{}); !errors.Is(err, ErrTooManyAttempts) {
+			t.Errorf("Esperado ErrTooManyAttempts, obtido %v", err)
+		}
+	})
+
+	t.Run("Deduplicação ignora links protegidos", func(t *testing.T) {
+		url, err := service.ShortenURL(ctx, "https://www.example.com/doc", domain.ShortenOptions{})
+		if err != nil {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+		if url.Existing || url.IsProtected() {
+			t.Error("Link público não deveria reutilizar link protegido")
+		}
+	})
+
+	t.Run("Senha longa demais", func(t *testing.T) {
+		_, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{Password: strings.Repeat("a", 73)})
+		if !errors.Is(err, ErrPasswordTooLong) {
+			t.Errorf("Esperado ErrPasswordTooLong, obtido %v", err)
+		}
+	})
+
+	t.Run("Remover senha", func(t *testing.T) {
+		empty := ""
+		url, err := service.UpdateURL(ctx, "", "secreto", domain.UpdateOptions{Password: &empty})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao remover senha: %v", err)
+		}
+		if url.IsProtected() {
+			t.Error("Link deveria estar desprotegido")
+		}
+		if _, err := service.ResolveRedirect(ctx, "", "secreto", domain.Visit{}); err != nil {
+			t.Errorf("Erro inesperado após remover senha: %v", err)
+		}
+	})
+}
+
+func TestPasswordAttemptsUnderConcurrency(t *testing.T) {
+	server := miniredis.RunT(t)
+	limiter := repository.NewRedisAttemptLimiter(redis.NewClient(&redis.Options{Addr: server.Addr()}), "password:attempts", 3, time.Minute)
+	service := NewURLService(newMockRepository(), "http://url.li", 24*time.Hour, WithPasswordThrottle(limiter))
+	ctx := context.Background()
+
+	if _, err := service.ShortenURL(ctx, "https://www.example.com/doc", domain.ShortenOptions{Alias: "secreto", Password: "hunter2"}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL protegida: %v", err)
+	}
+
+	var mu sync.Mutex
+	compared := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.UnlockRedirect(ctx, "", "secreto", "errada", domain.Visit{})
+			switch {
+			case errors.Is(err, ErrWrongPassword):
+				mu.Lock()
+				compared++
+				mu.Unlock()
+			case !errors.Is(err, ErrTooManyAttempts):
+				t.Errorf("Esperado ErrWrongPassword ou ErrTooManyAttempts, obtido %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if compared != 3 {
+		t.Errorf("Apenas 3 senhas deveriam ser comparadas em paralelo, obtido %d", compared)
+	}
+	if _, err := service.UnlockRedirect(ctx, "", "secreto", "hunter2", domain.Visit{}); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Senha correta deveria ser bloqueada após o limite, obtido %v", err)
+	}
+}
+
+type stubClickCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *stubClickCounter) Clicks(ctx context.Context, shortCode string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[shortCode], nil
+}
+
+func (c *stubClickCounter) IncrementClicks(ctx context.Context, shortCode string, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[shortCode]++
+	return c.counts[shortCode], nil
+}
+
+func (c *stubClickCounter) ExpireClicks(ctx context.Context, shortCode string, ttl time.Duration) error {
+	return nil
+}
+
+func (c *stubClickCounter) ResetLinkCounters(ctx context.Context, shortCode string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.counts, shortCode)
+	return nil
+}
+
+func TestClickLimitedURL(t *testing.T) {
+	repo := newMockRepository()
+	counter := &stubClickCounter{counts: make(map[string]int64)}
+	service := NewURLService(repo, "http://url.li", 24*time.Hour,
+		WithClickCounter(counter),
+		WithRedirectPolicy(http.StatusPermanentRedirect, time.Hour),
+	)
+	ctx := context.Background()
+
+	if _, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{MaxClicks: -1}); !errors.Is(err, ErrInvalidMaxClicks) {
+		t.Errorf("Esperado ErrInvalidMaxClicks, obtido %v", err)
+	}
+
+	if _, err := service.ShortenURL(ctx, "https://www.example.com/download", domain.ShortenOptions{Alias: "limitado", MaxClicks: 3}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	served, exhausted := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			redirect, err := service.ResolveRedirect(ctx, "", "limitado", domain.Visit{})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				served++
+				if redirect.CacheMaxAge != 0 {
+					t.Errorf("Redirect com limite de cliques não deveria ser cacheável, obtido %s", redirect.CacheMaxAge)
+				}
+			case errors.Is(err, domain.ErrExhausted):
+				exhausted++
+			default:
+				t.Errorf("Erro inesperado: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if served != 3 || exhausted != 7 {
+		t.Errorf("Esperados 3 redirects e 7 esgotados, obtidos %d e %d", served, exhausted)
+	}
+
+	dedupe := true
+	plain, err := service.ShortenURL(ctx, "https://www.example.com/download", domain.ShortenOptions{Dedupe: &dedupe})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao encurtar URL: %v", err)
+	}
+	if plain.Existing || plain.HasClickLimit() {
+		t.Error("Link sem limite não deveria reutilizar link com limite de cliques")
+	}
+
+	if err := service.PurgeURL(ctx, "", "limitado"); err != nil {
+		t.Fatalf("Erro inesperado ao remover URL: %v", err)
+	}
+	if _, ok := counter.counts["limitado"]; ok {
+		t.Error("Contador de cliques deveria ser zerado ao remover a URL")
+	}
+}
+
+func TestScheduledActivation(t *testing.T) {
+	repo := newMockRepository()
+	service := NewURLService(repo, "http://url.li", 24*time.Hour, WithDeduplication(true, false))
+	ctx := context.Background()
+
+	activatesAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	url, err := service.ShortenURL(ctx, "https://www.example.com/campanha", domain.ShortenOptions{
+		Alias:       "campanha",
+		ActivatesAt: &activatesAt,
+		TTL:         2 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL agendada: %v", err)
+	}
+	if want := activatesAt.Add(2 * time.Hour); !url.ExpiresAt.Equal(want) {
+		t.Errorf("TTL deveria contar a partir da ativação: esperado %s, obtido %s", want, url.ExpiresAt)
+	}
+
+	_, err = service.ResolveRedirect(ctx, "", "campanha", domain.Visit{})
+	var notActive *domain.NotActiveError
+	if !errors.As(err, &notActive) || !notActive.ActivatesAt.Equal(activatesAt) {
+		t.Errorf("Esperado NotActiveError com ativação em %s, obtido %v", activatesAt, err)
+	}
+	if !errors.Is(err, domain.ErrNotActive) {
+		t.Errorf("NotActiveError deveria corresponder a ErrNotActive")
+	}
+
+	if _, err := service.GetURLInfo(ctx, "", "campanha"); err != nil {
+		t.Errorf("Informações de URL agendada deveriam estar disponíveis, obtido %v", err)
+	}
+
+	t.Run("Deduplicação ignora links agendados", func(t *testing.T) {
+		url, err := service.ShortenURL(ctx, "https://www.example.com/campanha", domain.ShortenOptions{})
+		if err != nil {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+		if url.Existing {
+			t.Error("Link imediato não deveria reutilizar link agendado")
+		}
+	})
+
+	t.Run("Expiração antes da ativação", func(t *testing.T) {
+		expiresAt := activatesAt.Add(-time.Minute)
+		_, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{ActivatesAt: &activatesAt, ExpiresAt: &expiresAt})
+		if !errors.Is(err, ErrInvalidActivation) {
+			t.Errorf("Esperado ErrInvalidActivation, obtido %v", err)
+		}
+
+		later := url.ExpiresAt.Add(time.Hour)
+		_, err = service.UpdateURL(ctx, "", "campanha", domain.UpdateOptions{ActivatesAt: &later})
+		if !errors.Is(err, ErrInvalidActivation) {
+			t.Errorf("Esperado ErrInvalidActivation ao adiar ativação além da expiração, obtido %v", err)
+		}
+	})
+
+	t.Run("Antecipar ativação", func(t *testing.T) {
+		now := time.Now()
+		if _, err := service.UpdateURL(ctx, "", "campanha", domain.UpdateOptions{ActivatesAt: &now}); err != nil {
+			t.Fatalf("Erro inesperado ao antecipar ativação: %v", err)
+		}
+		if _, err := service.ResolveRedirect(ctx, "", "campanha", domain.Visit{}); err != nil {
+			t.Errorf("Erro inesperado após ativação: %v", err)
+		}
+	})
+
+	t.Run("Remover ativação", func(t *testing.T) {
+		if _, err := service.ShortenURL(ctx, "https://www.example.com/lancamento", domain.ShortenOptions{Alias: "lancamento", ActivatesAt: &activatesAt}); err != nil {
+			t.Fatalf("Erro inesperado ao criar URL agendada: %v", err)
+		}
+
+		_, err := service.UpdateURL(ctx, "", "lancamento", domain.UpdateOptions{ActivatesAt: &activatesAt, ActivateNow: true})
+		if !errors.Is(err, ErrInvalidActivation) {
+			t.Errorf("Esperado ErrInvalidActivation com activates_at e activate_now, obtido %v", err)
+		}
+
+		updated, err := service.UpdateURL(ctx, "", "lancamento", domain.UpdateOptions{ActivateNow: true})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao remover ativação: %v", err)
+		}
+		if updated.ActivatesAt != nil {
+			t.Errorf("Ativação deveria ter sido removida, obtida %s", updated.ActivatesAt)
+		}
+		if _, err := service.ResolveRedirect(ctx, "", "lancamento", domain.Visit{}); err != nil {
+			t.Errorf("Erro inesperado após remover ativação: %v", err)
+		}
+	})
+}
+
+func TestPreviewURL(t *testing.T) {
+	repo := newMockRepository()
+	recorder := NewAccessRecorder(repo, time.Hour)
+	service := NewURLService(repo, "http://url.li", 24*time.Hour, WithAccessRecorder(recorder), WithDeduplication(true, false))
+	ctx := context.Background()
+
+	if _, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{Alias: "previa", Preview: true}); err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+
+	url, err := service.PreviewURL(ctx, "", "previa", domain.Visit{})
+	if err != nil {
+		t.Fatalf("Erro inesperado na prévia: %v", err)
+	}
+	if url.LongURL != "https://www.example.com" || url.ShortURL != "http://url.li/previa" {
+		t.Errorf("Prévia inesperada: %s -> %s", url.ShortURL, url.LongURL)
+	}
+	if err := recorder.Flush(ctx); err != nil {
+		t.Fatalf("Erro inesperado no flush: %v", err)
+	}
+	if repo.urls["previa"].AccessCount != 0 {
+		t.Error("Prévia não deveria contar como acesso")
+	}
+
+	redirect, err := service.ResolveRedirect(ctx, "", "previa", domain.Visit{})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao resolver: %v", err)
+	}
+	if !redirect.Preview || redirect.Location != "https://www.example.com" {
+		t.Errorf("Visita deveria pedir a prévia com o destino: %+v", redirect)
+	}
+	if err := recorder.Flush(ctx); err != nil {
+		t.Fatalf("Erro inesperado no flush: %v", err)
+	}
+	if repo.urls["previa"].AccessCount != 0 {
+		t.Error("Visita que só vê a prévia não deveria contar como acesso")
+	}
+
+	redirect, err = service.ResolveRedirect(ctx, "", "previa", domain.Visit{Confirmed: true})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao resolver: %v", err)
+	}
+	if redirect.Preview || redirect.CacheMaxAge != 0 {
+		t.Errorf("Visita confirmada deveria ser redirecionada sem cache: %+v", redirect)
+	}
+	if err := recorder.Flush(ctx); err != nil {
+		t.Fatalf("Erro inesperado no flush: %v", err)
+	}
+	if repo.urls["previa"].AccessCount != 1 {
+		t.Errorf("Visita confirmada deveria contar como acesso, obtido %d", repo.urls["previa"].AccessCount)
+	}
+
+	t.Run("Prévia não usa cliques", func(t *testing.T) {
+		counter := &stubClickCounter{counts: make(map[string]int64)}
+		limited := NewURLService(newMockRepository(), "http://url.li", 24*time.Hour, WithClickCounter(counter))
+		if _, err := limited.ShortenURL(ctx, "https://www.example.com/unico", domain.ShortenOptions{Alias: "unico", Preview: true, MaxClicks: 1}); err != nil {
+			t.Fatalf("Erro inesperado ao criar URL: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if redirect, err := limited.ResolveRedirect(ctx, "", "unico", domain.Visit{}); err != nil || !redirect.Preview {
+				t.Fatalf("Esperada a prévia, obtido %+v, %v", redirect, err)
+			}
+		}
+		if counter.counts["unico"] != 0 {
+			t.Errorf("Prévia não deveria usar cliques, obtido %d", counter.counts["unico"])
+		}
+
+		if _, err := limited.ResolveRedirect(ctx, "", "unico", domain.Visit{Confirmed: true}); err != nil {
+			t.Fatalf("Erro inesperado ao continuar: %v", err)
+		}
+		if _, err := limited.ResolveRedirect(ctx, "", "unico", domain.Visit{}); !errors.Is(err, domain.ErrExhausted) {
+			t.Errorf("Link esgotado não deveria mostrar a prévia, obtido %v", err)
+		}
+		if _, err := limited.PreviewURL(ctx, "", "unico", domain.Visit{}); !errors.Is(err, domain.ErrExhausted) {
+			t.Errorf("Esperado ErrExhausted ao descrever link esgotado, obtido %v", err)
+		}
+	})
+
+	t.Run("Caminho extra", func(t *testing.T) {
+		if _, err := service.PreviewURL(ctx, "", "previa", domain.Visit{Path: "extra"}); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Esperado ErrNotFound para caminho extra sem repasse, obtido %v", err)
+		}
+	})
+
+	t.Run("Deduplicação ignora links com prévia", func(t *testing.T) {
+		url, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{})
+		if err != nil {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+		if url.Existing {
+			t.Error("Link sem prévia não deveria reutilizar link com prévia")
+		}
+	})
+
+	t.Run("Desativar prévia", func(t *testing.T) {
+		disabled := false
+		url, err := service.UpdateURL(ctx, "", "previa", domain.UpdateOptions{Preview: &disabled})
+		if err != nil {
+			t.Fatalf("Erro inesperado ao atualizar: %v", err)
+		}
+		if url.Preview {
+			t.Error("Prévia deveria estar desativada")
+		}
+	})
+
+	t.Run("Link agendado", func(t *testing.T) {
+		activatesAt := time.Now().Add(time.Hour)
+		service.ShortenURL(ctx, "https://www.example.com/breve", domain.ShortenOptions{Alias: "breve", ActivatesAt: &activatesAt})
+		if _, err := service.PreviewURL(ctx, "", "breve", domain.Visit{}); !errors.Is(err, domain.ErrNotActive) {
+			t.Errorf("Esperado ErrNotActive, obtido %v", err)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+	"golang.org/x/net/idna"
+)
+
+var ErrURLRejected = errors.New("destination URL rejected")
+
+// RejectionReason tells clients why a destination was refused.
+type RejectionReason string
+
+const (
+	RejectMalformed   RejectionReason = "malformed"
+	RejectDenylisted  RejectionReason = "denylisted"
+	RejectNotAllowed  RejectionReason = "not_allowlisted"
+	RejectUnsafe      RejectionReason = "unsafe"
+	RejectIPLiteral   RejectionReason = "ip_literal"
+	RejectHomograph   RejectionReason = "homograph"
+	RejectCredentials RejectionReason = "credentials"
+	RejectLoop        RejectionReason = "loop"
+	RejectShortener   RejectionReason = "shortener"
+)
+
+// RejectionError is returned for a destination a URLValidator refused. It
+// matches ErrURLRejected with errors.Is.
+type RejectionError struct {
+	Reason RejectionReason
+	Detail string
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrURLRejected, e.Detail)
+}
+
+func (e *RejectionError) Unwrap() error {
+	return ErrURLRejected
+}
+
+// URLValidator decides whether links may point at a destination. Validate
+// returns a *RejectionError for destinations that must not be shortened;
+// any other error means the check itself failed.
+type URLValidator interface {
+	Validate(ctx context.Context, destination *neturl.URL) error
+}
+
+// WithURLValidators checks every destination of new and updated links with
+// validators, in order, stopping at the first rejection.
+func WithURLValidators(validators ...URLValidator) Option {
+	return func(s *URLService) {
+		s.validators = append(s.validators, validators...)
+	}
+}
+
+// linkDestinations lists every URL a link can send visitors to. An empty
+// longURL is left out, for updates that only change rules or variants.
+func linkDestinations(longURL string, rules []domain.TargetingRule, variants []domain.Variant) []string {
+	var destinations []string
+	if longURL != "" {
+		destinations = append(destinations, longURL)
+	}
+	for _, rule := range rules {
+		destinations = append(destinations, rule.Destination)
+	}
+	for _, variant := range variants {
+		destinations = append(destinations, variant.Destination)
+	}
+	return destinations
+}
+
+func (s *URLService) checkDestinations(ctx context.Context, destinations ...string) error {
+	if len(s.validators) == 0 {
+		return nil
+	}
+	for _, destination := range destinations {
+		parsed, err := neturl.Parse(destination)
+		if err != nil || parsed.Hostname() == "" {
+			return &RejectionError{Reason: RejectMalformed, Detail: fmt.Sprintf("%s is not a valid URL", destination)}
+		}
+		for _, validator := range s.validators {
+			if err := validator.Validate(ctx, parsed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ipLiteralPattern matches hosts browsers read as IPv4 addresses, including
+// the integer, octal and hexadecimal spellings used to disguise them.
+var ipLiteralPattern = regexp.MustCompile(`^(0x[0-9a-f]+|[0-9]+)(\.(0x[0-9a-f]+|[0-9]+)){0,3}$`)
+
+// confusables are Cyrillic and Greek letters drawn like Latin ones. A label
+// spelled only with them reads as a Latin word it is not.
+const confusables = "аеорсухіјѕԁԛԝһӏαορνυικχε"
+
+// HeuristicValidator rejects destinations shaped to mislead visitors about
+// where they lead: hosts given as IP addresses, look-alike international
+// domain names and URLs carrying credentials (https://bank.com@evil.com).
+type HeuristicValidator struct{}
+
+func (HeuristicValidator) Validate(ctx context.Context, destination *neturl.URL) error {
+	if destination.User != nil {
+		return &RejectionError{Reason: RejectCredentials, Detail: "URLs with credentials are not allowed"}
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(destination.Hostname()), ".")
+	if net.ParseIP(host) != nil || ipLiteralPattern.MatchString(host) {
+		return &RejectionError{Reason: RejectIPLiteral, Detail: fmt.Sprintf("host %s is an IP address", host)}
+	}
+
+	unicodeHost, err := idna.ToUnicode(host)
+	if err != nil {
+		return &RejectionError{Reason: RejectHomograph, Detail: fmt.Sprintf("host %s is not a valid international domain name", host)}
+	}
+	for _, label := range strings.Split(unicodeHost, ".") {
+		if isHomograph(label) {
+			return &RejectionError{Reason: RejectHomograph, Detail: fmt.Sprintf("host %s imitates another domain", host)}
+		}
+	}
+	return nil
+}
+
+// isHomograph reports whether a host label mixes Latin, Cyrillic and Greek
+// letters, or is written only with Cyrillic and Greek look-alikes of Latin
+// letters. Other scripts are left alone.
+func isHomograph(label string) bool {
+	var latin, cyrillic, greek, letters, lookalikes int
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		}
+		if strings.ContainsRune(confusables, r) {
+			lookalikes++
+		}
+	}
+
+	scripts := 0
+	for _, count := range []int{latin, cyrillic, greek} {
+		if count > 0 {
+			scripts++
+		}
+	}
+	if scripts > 1 {
+		return true
+	}
+	return latin == 0 && letters > 0 && lookalikes == letters
+}
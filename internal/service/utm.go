@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+var ErrInvalidUTM = errors.New("utm values must be at most 255 characters")
+
+const maxUTMLength = 255
+
+// WithUTMTemplates fills in the UTM parameters a new link leaves empty from
+// its owner's template.
+func WithUTMTemplates(templates domain.UTMTemplateRepository) Option {
+	return func(s *URLService) {
+		s.utmTemplates = templates
+	}
+}
+
+func normalizeUTM(utm domain.UTM) (domain.UTM, error) {
+	for _, value := range []*string{&utm.Source, &utm.Medium, &utm.Campaign, &utm.Term, &utm.Content} {
+		*value = strings.TrimSpace(*value)
+		if len([]rune(*value)) > maxUTMLength {
+			return domain.UTM{}, ErrInvalidUTM
+		}
+	}
+	return utm, nil
+}
+
+// defaultUTM returns the owner's template, or nothing when there is no
+// template store, no owner or no template. A failing store only logs, so
+// links can still be created without their defaults.
+func (s *URLService) defaultUTM(ctx context.Context, owner string) domain.UTM {
+	if s.utmTemplates == nil || owner == "" {
+		return domain.UTM{}
+	}
+	template, err := s.utmTemplates.Find(ctx, owner)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.Printf("Failed to load UTM template for %s: %v", owner, err)
+		}
+		return domain.UTM{}
+	}
+	return template.UTM
+}
+
+// GetUTMTemplate returns the default UTM parameters of an account.
+func (s *URLService) GetUTMTemplate(ctx context.Context, owner string) (*domain.UTMTemplate, error) {
+	if s.utmTemplates == nil {
+		return nil, domain.ErrNotFound
+	}
+	return s.utmTemplates.Find(ctx, owner)
+}
+
+// SaveUTMTemplate sets the default UTM parameters of an account. Links that
+// already exist keep the parameters they were created with.
+func (s *URLService) SaveUTMTemplate(ctx context.Context, owner string, utm domain.UTM) (*domain.UTMTemplate, error) {
+	if s.utmTemplates == nil {
+		return nil, errors.New("UTM templates are not enabled")
+	}
+
+	utm, err := normalizeUTM(utm)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &domain.UTMTemplate{Owner: owner, UTM: utm, UpdatedAt: time.Now()}
+	if err := s.utmTemplates.Save(ctx, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func (s *URLService) DeleteUTMTemplate(ctx context.Context, owner string) error {
+	if s.utmTemplates == nil {
+		return domain.ErrNotFound
+	}
+	return s.utmTemplates.Delete(ctx, owner)
+}
+
+// withUTM adds the link's UTM parameters to destination. Parameters the
+// destination already sets are left alone, and the existing query is kept
+// byte for byte so its encoding is not rewritten.
+func withUTM(destination string, url *domain.URL, shortCode string) string {
+	if url.UTM.IsZero() {
+		return destination
+	}
+
+	target, err := neturl.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	expand := strings.NewReplacer("{code}", shortCode, "{title}", url.Title)
+	existing := target.Query()
+	added := neturl.Values{}
+	for _, param := range []struct{ key, value string }{
+		{"utm_source", url.UTM.Source},
+		{"utm_medium", url.UTM.Medium},
+		{"utm_campaign", url.UTM.Campaign},
+		{"utm_term", url.UTM.Term},
+		{"utm_content", url.UTM.Content},
+	} {
+		if param.value == "" || existing.Has(param.key) {
+			continue
+		}
+		added.Set(param.key, expand.Replace(param.value))
+	}
+	if len(added) == 0 {
+		return destination
+	}
+
+	if target.RawQuery == "" {
+		target.RawQuery = added.Encode()
+	} else {
+		target.RawQuery = fmt.Sprintf("%s&%s", target.RawQuery, added.Encode())
+	}
+	return target.String()
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+type mockUTMTemplates struct {
+	templates map[string]*domain.UTMTemplate
+}
+
+func (m *mockUTMTemplates) Find(ctx context.Context, owner string) (*domain.UTMTemplate, error) {
+	template, exists := m.templates[owner]
+	if !exists {
+		return nil, domain.ErrNotFound
+	}
+	copied := *template
+	return &copied, nil
+}
+
+func (m *mockUTMTemplates) Save(ctx context.Context, template *domain.UTMTemplate) error {
+	copied := *template
+	m.templates[template.Owner] = &copied
+	return nil
+}
+
+func (m *mockUTMTemplates) Delete(ctx context.Context, owner string) error {
+	if _, exists := m.templates[owner]; !exists {
+		return domain.ErrNotFound
+	}
+	delete(m.templates, owner)
+	return nil
+}
+
+func TestWithUTM(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		utm         domain.UTM
+		want        string
+	}{
+		{
+			"Sem UTM",
+			"https://www.example.com/promo",
+			domain.UTM{},
+			"https://www.example.com/promo",
+		},
+		{
+			"Destino sem query",
+			"https://www.example.com/promo",
+			domain.UTM{Source: "newsletter", Medium: "email"},
+			"https://www.example.com/promo?utm_medium=email&utm_source=newsletter",
+		},
+		{
+			"Mantém query e codificação existentes",
+			"https://www.example.com/busca?q=caf%C3%A9+com+leite&utm_source=site#resultados",
+			domain.UTM{Source: "newsletter", Campaign: "black friday & cia"},
+			"https://www.example.com/busca?q=caf%C3%A9+com+leite&utm_source=site&utm_campaign=black+friday+%26+cia#resultados",
+		},
+		{
+			"Placeholders",
+			"https://www.example.com",
+			domain.UTM{Campaign: "{code}", Content: "{title}"},
+			"https://www.example.com?utm_campaign=promo&utm_content=Oferta+de+ver%C3%A3o",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := &domain.URL{Title: "Oferta de verão", UTM: tt.utm}
+			if got := withUTM(tt.destination, url, "promo"); got != tt.want {
+				t.Errorf("Destino esperado %s, obtido %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestShortenURLWithUTMTemplate(t *testing.T) {
+	templates := &mockUTMTemplates{templates: make(map[string]*domain.UTMTemplate)}
+	service := NewURLService(newMockRepository(), "http://url.li", 24*time.Hour, WithUTMTemplates(templates))
+	ctx := context.Background()
+
+	if _, err := service.SaveUTMTemplate(ctx, "acme", domain.UTM{Source: "acme", Medium: "social"}); err != nil {
+		t.Fatalf("Erro inesperado ao salvar template: %v", err)
+	}
+
+	url, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{
+		Alias: "campanha",
+		Owner: "acme",
+		UTM:   domain.UTM{Medium: "email", Campaign: "lancamento"},
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	want := domain.UTM{Source: "acme", Medium: "email", Campaign: "lancamento"}
+	if url.UTM != want {
+		t.Errorf("UTM esperado %+v, obtido %+v", want, url.UTM)
+	}
+
+	redirect, err := service.ResolveRedirect(ctx, "", "campanha", domain.Visit{})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if redirect.Location != "https://www.example.com?utm_campaign=lancamento&utm_medium=email&utm_source=acme" {
+		t.Errorf("Destino inesperado: %s", redirect.Location)
+	}
+	if redirect.Destination != "https://www.example.com" {
+		t.Errorf("Destino base esperado https://www.example.com, obtido %s", redirect.Destination)
+	}
+
+	other, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{Owner: "outra"})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+	if !other.UTM.IsZero() {
+		t.Errorf("Template de outra conta não deveria ser aplicado, obtido %+v", other.UTM)
+	}
+
+	_, err = service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{UTM: domain.UTM{Term: strings.Repeat("x", 256)}})
+	if !errors.Is(err, ErrInvalidUTM) {
+		t.Errorf("Esperado ErrInvalidUTM, obtido %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	neturl "net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+var ErrInvalidVariant = errors.New("invalid variant")
+
+const maxVariants = 10
+
+var variantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// normalizeVariants validates A/B variants and returns them in canonical
+// form. Unnamed variants are called A, B, C... after their position.
+func normalizeVariants(variants []domain.Variant) ([]domain.Variant, error) {
+	if len(variants) > maxVariants {
+		return nil, fmt.Errorf("%w: a link may have at most %d variants", ErrInvalidVariant, maxVariants)
+	}
+
+	normalized := make([]domain.Variant, 0, len(variants))
+	names := make(map[string]bool, len(variants))
+	total := 0
+	for i, variant := range variants {
+		variant.Name = strings.TrimSpace(variant.Name)
+		if variant.Name == "" {
+			variant.Name = string(rune('A' + i))
+		}
+		if !variantNamePattern.MatchString(variant.Name) {
+			return nil, fmt.Errorf("%w: variant %d: name must be 1 to 32 letters, digits, '-' or '_'", ErrInvalidVariant, i+1)
+		}
+		if names[variant.Name] {
+			return nil, fmt.Errorf("%w: variant name %q is used twice", ErrInvalidVariant, variant.Name)
+		}
+		names[variant.Name] = true
+
+		if variant.Weight < 0 {
+			return nil, fmt.Errorf("%w: variant %q: weight must not be negative", ErrInvalidVariant, variant.Name)
+		}
+		total += variant.Weight
+
+		destination := strings.TrimSpace(variant.Destination)
+		if destination != "" && !hasProtocol(destination) {
+			destination = "https://" + destination
+		}
+		if parsed, err := neturl.Parse(destination); err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: variant %q: destination must be a valid URL", ErrInvalidVariant, variant.Name)
+		}
+		variant.Destination = destination
+
+		variant.ID = 0
+		variant.URLID = ""
+		variant.Position = i
+		normalized = append(normalized, variant)
+	}
+
+	if len(normalized) > 0 && total == 0 {
+		return nil, fmt.Errorf("%w: at least one variant needs a positive weight", ErrInvalidVariant)
+	}
+	return normalized, nil
+}
+
+func sameVariants(a, b []domain.Variant) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		x.ID, x.URLID, y.ID, y.URLID = 0, "", 0, ""
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// chooseVariant returns the variant a visitor was already given when it is
+// still receiving traffic, and otherwise draws one at random by weight.
+func chooseVariant(variants []domain.Variant, assigned string) *domain.Variant {
+	total := 0
+	for i := range variants {
+		if variants[i].Weight <= 0 {
+			continue
+		}
+		if variants[i].Name == assigned {
+			return &variants[i]
+		}
+		total += variants[i].Weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	pick := rand.IntN(total)
+	for i := range variants {
+		if variants[i].Weight <= 0 {
+			continue
+		}
+		if pick < variants[i].Weight {
+			return &variants[i]
+		}
+		pick -= variants[i].Weight
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kakuzops/ml-url/internal/domain"
+)
+
+func TestNormalizeVariants(t *testing.T) {
+	variants, err := normalizeVariants([]domain.Variant{
+		{Destination: "www.example.com/a", Weight: 70},
+		{Name: "nova-home", Destination: "https://www.example.com/b", Weight: 30},
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if variants[0].Name != "A" || variants[0].Destination != "https://www.example.com/a" {
+		t.Errorf("Variante sem nome deveria virar A com https, obtida %+v", variants[0])
+	}
+	if variants[1].Name != "nova-home" || variants[1].Position != 1 {
+		t.Errorf("Variante nomeada inesperada: %+v", variants[1])
+	}
+}
+
+func TestNormalizeVariantsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []domain.Variant
+	}{
+		{"Nome repetido", []domain.Variant{
+			{Name: "A", Destination: "https://www.example.com/a", Weight: 1},
+			{Name: "A", Destination: "https://www.example.com/b", Weight: 1},
+		}},
+		{"Nome inválido", []domain.Variant{{Name: "com espaço", Destination: "https://www.example.com", Weight: 1}}},
+		{"Peso negativo", []domain.Variant{{Destination: "https://www.example.com", Weight: -1}}},
+		{"Todos os pesos zerados", []domain.Variant{{Destination: "https://www.example.com", Weight: 0}}},
+		{"Sem destino", []domain.Variant{{Weight: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := normalizeVariants(tt.variants); !errors.Is(err, ErrInvalidVariant) {
+				t.Errorf("Esperado ErrInvalidVariant, obtido %v", err)
+			}
+		})
+	}
+}
+
+func TestChooseVariant(t *testing.T) {
+	variants := []domain.Variant{
+		{Name: "A", Weight: 70},
+		{Name: "B", Weight: 30},
+		{Name: "pausada", Weight: 0},
+	}
+
+	t.Run("Mantém a variante do visitante", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			if variant := chooseVariant(variants, "B"); variant.Name != "B" {
+				t.Fatalf("Variante esperada B, obtida %s", variant.Name)
+			}
+		}
+	})
+
+	t.Run("Distribui por peso", func(t *testing.T) {
+		counts := make(map[string]int)
+		for i := 0; i < 10000; i++ {
+			counts[chooseVariant(variants, "").Name]++
+		}
+		if counts["pausada"] != 0 {
+			t.Errorf("Variante pausada não deveria receber tráfego, recebeu %d", counts["pausada"])
+		}
+		if counts["A"] < 6500 || counts["A"] > 7500 {
+			t.Errorf("Esperado cerca de 7000 visitas para A, obtido %d", counts["A"])
+		}
+	})
+
+	t.Run("Reatribui variante pausada", func(t *testing.T) {
+		if variant := chooseVariant(variants, "pausada"); variant.Name == "pausada" {
+			t.Error("Variante pausada não deveria ser mantida")
+		}
+	})
+}
+
+func TestResolveRedirectWithVariants(t *testing.T) {
+	repo := newMockRepository()
+	service := NewURLService(repo, "http://url.li", 24*time.Hour,
+		WithRedirectPolicy(http.StatusMovedPermanently, time.Hour),
+	)
+	ctx := context.Background()
+
+	_, err := service.ShortenURL(ctx, "https://www.example.com", domain.ShortenOptions{
+		Alias: "teste-ab",
+		Rules: []domain.TargetingRule{{OS: "ios", Destination: "https://apps.apple.com/app/id1"}},
+		Variants: []domain.Variant{
+			{Name: "A", Destination: "https://www.example.com/a", Weight: 1},
+			{Name: "B", Destination: "https://www.example.com/b", Weight: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao criar URL: %v", err)
+	}
+
+	redirect, err := service.ResolveRedirect(ctx, "", "teste-ab", domain.Visit{UserAgent: windowsUA, Variant: "B"})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if redirect.Location != "https://www.example.com/b" || redirect.Variant != "B" {
+		t.Errorf("Esperado variante B, obtido %s (%s)", redirect.Variant, redirect.Location)
+	}
+	if redirect.CacheMaxAge != 0 {
+		t.Errorf("Redirect com variantes não deveria ser cacheável, obtido %s", redirect.CacheMaxAge)
+	}
+
+	redirect, err = service.ResolveRedirect(ctx, "", "teste-ab", domain.Visit{UserAgent: iPhoneUA, Variant: "B"})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if redirect.Location != "https://apps.apple.com/app/id1" || redirect.Variant != "" {
+		t.Errorf("Regra deveria ter prioridade sobre as variantes, obtido %s (%s)", redirect.Location, redirect.Variant)
+	}
+
+	empty := []domain.Variant{}
+	url, err := service.UpdateURL(ctx, "", "teste-ab", domain.UpdateOptions{Variants: &empty})
+	if err != nil {
+		t.Fatalf("Erro inesperado ao remover variantes: %v", err)
+	}
+	if len(url.Variants) != 0 {
+		t.Errorf("Variantes deveriam ter sido removidas, obtidas %d", len(url.Variants))
+	}
+}